@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zyedidia/generic/mapset"
+)
+
+// A podcast can be made private by giving it access tokens, one per
+// subscriber. The files that belong to a private podcast are then only served
+// when the request URL carries one of its tokens, either as a path prefix
+// (/t/TOKEN/meta/SHORT_NAME.xml) or as a query parameter
+// (/meta/SHORT_NAME.xml?token=TOKEN). Private feeds are written to disk with a
+// placeholder in place of the token, which is replaced with the subscriber's
+// own token when the feed is served, so that the episode URLs in it work for
+// them.
+
+const (
+	accessTokenPathPrefix  = "/t/"
+	accessTokenQueryParam  = "token"
+	accessTokenPlaceholder = "yt2pod-subscriber-token"
+)
+
+var accessTokenFormat = regexp.MustCompile(`^[[:alnum:]_-]{16,}$`)
+
+func (p *podcast) isPrivate() bool {
+	return len(p.AccessTokens) > 0 || p.AccessTokensFile != ""
+}
+
+// The path prefix for a private podcast's URLs, which has the placeholder in
+// place of the token.
+func (p *podcast) urlPrefix() string {
+	if !p.isPrivate() {
+		return ""
+	}
+	return strings.TrimPrefix(accessTokenPathPrefix, "/") + accessTokenPlaceholder + "/"
+}
+
+// ------------------------------------------------------------
+
+// A private podcast's tokens, keyed by subscriber name. Those from the token
+// file are re-read whenever it's modified, so a subscriber's token can be
+// revoked by removing their line from it.
+type accessTokens struct {
+	fromConfig map[string]string
+	filePath   string
+
+	mu       sync.Mutex
+	fileMod  time.Time
+	fromFile map[string]string
+}
+
+func newAccessTokens(pod *podcast) *accessTokens {
+	if !pod.isPrivate() {
+		return nil
+	}
+	t := accessTokens{fromConfig: pod.AccessTokens, filePath: pod.AccessTokensFile}
+	if t.filePath != "" {
+		t.reloadFile()
+		if t.fromFile == nil {
+			log.Printf("%s: Access tokens file %s could not be read", pod, t.filePath)
+		}
+	}
+	return &t
+}
+
+// Returns the name of the subscriber whose token is token, if any.
+func (t *accessTokens) subscriber(token string) (string, bool) {
+	if name, ok := findAccessToken(t.fromConfig, token); ok {
+		return name, true
+	}
+	if t.filePath == "" {
+		return "", false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reloadFile()
+	return findAccessToken(t.fromFile, token)
+}
+
+func findAccessToken(tokens map[string]string, token string) (string, bool) {
+	for name, candidate := range tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// The token file has a line for each subscriber, consisting of their name and
+// then their token, separated by whitespace. Blank lines and lines starting
+// with # are ignored.
+//
+// The caller must hold t.mu.
+func (t *accessTokens) reloadFile() {
+	info, err := os.Stat(t.filePath)
+	if err != nil {
+		if t.fromFile != nil {
+			log.Printf("Access tokens file unavailable, so none of its tokens are valid: %v", err)
+		}
+		t.fromFile, t.fileMod = nil, time.Time{}
+		return
+	}
+	if info.ModTime().Equal(t.fileMod) {
+		return
+	}
+	buf, err := os.ReadFile(t.filePath)
+	if err != nil {
+		log.Printf("Reading access tokens file failed: %v", err)
+		return
+	}
+	fromFile := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !accessTokenFormat.MatchString(fields[1]) {
+			log.Printf("%s:%d: Ignoring malformed access token line", t.filePath, lineNum)
+			continue
+		}
+		fromFile[fields[0]] = fields[1]
+	}
+	t.fromFile, t.fileMod = fromFile, info.ModTime()
+	log.Printf("Loaded %d access tokens from %s", len(fromFile), t.filePath)
+}
+
+// ------------------------------------------------------------
+
+// Keeps track of which podcasts files served from the data directory belong
+// to, and which of those podcasts are private.
+type accessControl struct {
+	mu       sync.RWMutex
+	podcasts map[string]*podcastAccess // Keyed by podcast short name
+}
+
+type podcastAccess struct {
+	feedPath string
+	// nil if the podcast is public.
+	tokens *accessTokens
+	// Paths relative to the data directory.
+	paths mapset.Set[string]
+}
+
+//nolint:gochecknoglobals
+var podcastAccessControl = &accessControl{podcasts: make(map[string]*podcastAccess)}
+
+// Register pod, or update its tokens if it's already registered.
+func (ac *accessControl) setPodcast(pod *podcast) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	pa, ok := ac.podcasts[pod.ShortName]
+	if !ok {
+		pa = &podcastAccess{feedPath: filepath.ToSlash(pod.feedPath()), paths: mapset.New[string]()}
+		ac.podcasts[pod.ShortName] = pa
+	}
+	pa.tokens = newAccessTokens(pod)
+}
+
+// Record that paths are all the files that belong to the podcast named
+// shortName.
+func (ac *accessControl) setPaths(shortName string, paths []string) {
+	set := mapset.New[string]()
+	for _, p := range paths {
+		set.Put(filepath.ToSlash(p))
+	}
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if pa, ok := ac.podcasts[shortName]; ok {
+		pa.paths = set
+	}
+}
+
+// Unregister the podcast named shortName. If it was private, its files stay
+// private, but no token is valid for them anymore.
+func (ac *accessControl) removePodcast(shortName string) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if pa, ok := ac.podcasts[shortName]; ok && pa.tokens != nil {
+		pa.tokens = &accessTokens{}
+	} else {
+		delete(ac.podcasts, shortName)
+	}
+}
+
+// Decide whether the file at relPath may be served to a request carrying
+// token (which may be empty). If any podcasts are private, files that don't
+// belong to a public podcast need a valid token, and directories aren't listed
+// at all.
+func (ac *accessControl) check(relPath string, isDir bool, token string) (allowed, isPrivateFeed bool) {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+
+	var anyPrivate, publiclyOwned bool
+	for _, pa := range ac.podcasts {
+		if pa.tokens == nil {
+			publiclyOwned = publiclyOwned || pa.paths.Has(relPath)
+			continue
+		}
+		anyPrivate = true
+		if allowed || token == "" || !pa.paths.Has(relPath) {
+			continue
+		}
+		if _, ok := pa.tokens.subscriber(token); ok {
+			allowed, isPrivateFeed = true, relPath == pa.feedPath
+		}
+	}
+	switch {
+	case !anyPrivate:
+		return true, false
+	case isDir:
+		return false, false
+	case publiclyOwned && !isPrivateFeed:
+		return true, false
+	default:
+		return allowed, isPrivateFeed
+	}
+}
+
+// Returns whether details of the podcast with shortName (such as its
+// statistics) may be reported in response to a request carrying token (which
+// may be empty). Those of public podcasts may be, and those of private ones
+// only to their subscribers. While any podcasts are private, those that
+// aren't known (e.g. because they've been removed from the config) aren't
+// reported.
+func (ac *accessControl) mayReport(shortName, token string) bool {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	pa, known := ac.podcasts[shortName]
+	if !known {
+		for _, pa := range ac.podcasts {
+			if pa.tokens != nil {
+				return false
+			}
+		}
+		return true
+	}
+	if pa.tokens == nil {
+		return true
+	}
+	if token == "" {
+		return false
+	}
+	_, ok := pa.tokens.subscriber(token)
+	return ok
+}
+
+// Returns a function reporting whether details of a podcast may be reported
+// in response to r.
+func (ac *accessControl) reportFilter(r *http.Request) func(shortName string) bool {
+	token := requestAccessToken(r)
+	return func(shortName string) bool {
+		return ac.mayReport(shortName, token)
+	}
+}
+
+// Wrap next (which serves the data directory) so that private podcasts' files
+// are only served to requests carrying a valid token.
+func (ac *accessControl) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, urlPath := splitAccessToken(r.URL.Path)
+		token := requestAccessToken(r)
+		isDir := strings.HasSuffix(urlPath, "/")
+		relPath := strings.TrimPrefix(path.Clean(urlPath), "/")
+
+		allowed, isPrivateFeed := ac.check(relPath, isDir, token)
+		if !allowed || relPath == filepath.ToSlash(statsPath) {
+			// The statistics are only available via their own handler,
+			// which leaves out those of private podcasts.
+			http.NotFound(w, r)
+			return
+		}
+		cw := &countingResponseWriter{ResponseWriter: w}
+		if isPrivateFeed {
+			serveFeedWithToken(cw, r, relPath, token)
+		} else {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = urlPath
+			r2.URL.RawPath = ""
+			next.ServeHTTP(cw, r2)
+		}
+		if cw.n > 0 {
+			for _, shortName := range ac.owners(relPath) {
+				metrics.podcast(shortName).bytesServed.Add(cw.n)
+			}
+		}
+		stats.record(r, relPath, cw.statusCode(), cw.n)
+	})
+}
+
+// Returns the token that r carries, if any, either as a path prefix or as a
+// query parameter.
+func requestAccessToken(r *http.Request) string {
+	if token, _ := splitAccessToken(r.URL.Path); token != "" {
+		return token
+	}
+	return r.URL.Query().Get(accessTokenQueryParam)
+}
+
+// Split the token path prefix, if any, from urlPath.
+func splitAccessToken(urlPath string) (token, rest string) {
+	rest, ok := strings.CutPrefix(urlPath, accessTokenPathPrefix)
+	if !ok {
+		return "", urlPath
+	}
+	token, rest, _ = strings.Cut(rest, "/")
+	return token, "/" + rest
+}
+
+// Returns the short names of the podcasts that the file at relPath belongs
+// to.
+func (ac *accessControl) owners(relPath string) []string {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	var shortNames []string
+	for shortName, pa := range ac.podcasts {
+		if pa.paths.Has(relPath) {
+			shortNames = append(shortNames, shortName)
+		}
+	}
+	return shortNames
+}
+
+func serveFeedWithToken(w http.ResponseWriter, r *http.Request, relPath, token string) {
+	f, err := os.Open(relPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(f); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Tokens only contain characters that are safe in both URLs and XML.
+	feed := bytes.ReplaceAll(buf.Bytes(), []byte(accessTokenPlaceholder), []byte(token))
+	w.Header().Set("Cache-Control", "private")
+	http.ServeContent(w, r, relPath, info.ModTime(), bytes.NewReader(feed))
+}
+
+// Returns an error if any of pod's configured tokens are malformed.
+func (p *podcast) checkAccessTokens() error {
+	for name, token := range p.AccessTokens {
+		if !accessTokenFormat.MatchString(token) {
+			return fmt.Errorf("podcast %q: access token for %q must be at least 16 letters, digits, underscores or hyphens",
+				p.ShortName, name)
+		}
+	}
+	return nil
+}
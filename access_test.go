@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessControlMayReport(t *testing.T) {
+	const token = "subscriber-token-0123456789"
+	ac := &accessControl{podcasts: make(map[string]*podcastAccess)}
+	ac.setPodcast(&podcast{ShortName: "public"})
+	ac.setPodcast(&podcast{ShortName: "private", AccessTokens: map[string]string{"alice": token}})
+
+	for _, tc := range []struct {
+		url, shortName string
+		want           bool
+	}{
+		{"/stats", "public", true},
+		{"/stats", "private", false},
+		{"/stats", "removed", false},
+		{"/stats?token=wrong-token-0123456789", "private", false},
+		{"/stats?token=" + token, "private", true},
+		{"/metrics?token=" + token, "public", true},
+	} {
+		r := httptest.NewRequest("GET", tc.url, nil)
+		if got := ac.reportFilter(r)(tc.shortName); got != tc.want {
+			t.Errorf("may report %s for %s = %v, want %v", tc.shortName, tc.url, got, tc.want)
+		}
+	}
+
+	ac.removePodcast("private")
+	ac.removePodcast("public")
+	if ac.mayReport("private", token) {
+		t.Errorf("removed private podcast is still reported to its subscribers")
+	}
+}
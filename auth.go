@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Optionally, requests to the built-in webserver can be required to come from
+// an allowed network and/or to carry HTTP Basic auth credentials. The rule
+// that applies to a request is the one with the longest path prefix that
+// matches its path, with the top-level rule applying to paths that no other
+// rule matches.
+//
+// Episode files are shared between podcasts (in the episodes directory), so a
+// rule for a podcast's feed doesn't protect its episodes. Access tokens do.
+
+const authRealm = "yt2pod"
+
+type authRule struct {
+	PathPrefix string `json:"path_prefix" validate:"omitempty,startswith=/"`
+	// bcrypt hashes of passwords, keyed by username.
+	Users      map[string]string `json:"users"       validate:"-"`
+	AllowCIDRs []string          `json:"allow_cidrs" validate:"dive,cidr"`
+}
+
+type authConfig struct {
+	authRule
+	ExemptHealth bool       `json:"exempt_health" validate:"-"`
+	Paths        []authRule `json:"paths"         validate:"dive"`
+}
+
+// ------------------------------------------------------------
+
+type compiledAuthRule struct {
+	prefix string
+	users  map[string]string
+	nets   []*net.IPNet
+}
+
+type authenticator struct {
+	// Sorted so that longer prefixes come first.
+	rules        []*compiledAuthRule
+	exemptHealth bool
+
+	// Checking a bcrypt hash is deliberately slow, and podcast clients make
+	// lots of requests, so credentials that have been found to be correct are
+	// remembered (hashed, along with the bcrypt hash they matched).
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]bool
+}
+
+func newAuthenticator(cfg *authConfig) (*authenticator, error) {
+	a := authenticator{
+		exemptHealth: cfg.ExemptHealth,
+		verified:     make(map[[sha256.Size]byte]bool),
+	}
+	topLevel := cfg.authRule
+	topLevel.PathPrefix = "/"
+	for _, rule := range append([]authRule{topLevel}, cfg.Paths...) {
+		compiled := compiledAuthRule{prefix: rule.PathPrefix, users: rule.Users}
+		for username, hash := range rule.Users {
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return nil, fmt.Errorf("auth: password hash for %q: %w", username, err)
+			}
+		}
+		for _, cidr := range rule.AllowCIDRs {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("auth: %w", err)
+			}
+			compiled.nets = append(compiled.nets, ipNet)
+		}
+		a.rules = append(a.rules, &compiled)
+	}
+	sort.SliceStable(a.rules, func(i, j int) bool {
+		return len(a.rules[i].prefix) > len(a.rules[j].prefix)
+	})
+	return &a, nil
+}
+
+// Wrap next so that requests are only passed on to it if they satisfy the
+// rule that applies to them.
+func (a *authenticator) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.exemptHealth && isHealthPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rule := a.match(authPath(r.URL.Path))
+		if len(rule.nets) > 0 && !rule.allowsAddr(r.RemoteAddr) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if len(rule.users) > 0 {
+			username, password, ok := r.BasicAuth()
+			if !ok || !a.checkPassword(rule, username, password) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, authRealm))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The path that rules are matched against: that of the file that would be
+// served, regardless of any access token prefix or dot segments in urlPath.
+func authPath(urlPath string) string {
+	isDir := strings.HasSuffix(urlPath, "/")
+	// As the access control handler does.
+	_, urlPath = splitAccessToken(urlPath)
+	cleaned := path.Clean("/" + urlPath)
+	if isDir && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func (a *authenticator) match(urlPath string) *compiledAuthRule {
+	for _, rule := range a.rules {
+		if strings.HasPrefix(urlPath, rule.prefix) {
+			return rule
+		}
+	}
+	// Unreachable, because the top-level rule matches every path.
+	return a.rules[len(a.rules)-1]
+}
+
+func (rule *compiledAuthRule) allowsAddr(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range rule.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *authenticator) checkPassword(rule *compiledAuthRule, username, password string) bool {
+	hash, ok := rule.users[username]
+	if !ok {
+		return false
+	}
+	key := sha256.Sum256([]byte(hash + "\x00" + password))
+	a.mu.Lock()
+	known := a.verified[key]
+	a.mu.Unlock()
+	if known {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+	a.mu.Lock()
+	a.verified[key] = true
+	a.mu.Unlock()
+	return true
+}
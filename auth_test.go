@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestAuthenticatorMatch(t *testing.T) {
+	a, err := newAuthenticator(&authConfig{
+		Paths: []authRule{
+			{PathPrefix: "/meta/secret", Users: map[string]string{}},
+			{PathPrefix: "/ep/"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		urlPath, wantPrefix string
+	}{
+		{"/meta/secret.xml", "/meta/secret"},
+		{"/t/anything/meta/secret.xml", "/meta/secret"},
+		{"/t/anything/../meta/secret.xml", "/meta/secret"},
+		{"/meta/../meta/./secret.xml", "/meta/secret"},
+		{"//meta/secret.xml", "/meta/secret"},
+		{"/meta/other.xml", "/"},
+		{"/t/anything/ep/", "/ep/"},
+		{"/ep", "/"},
+		{"/", "/"},
+	} {
+		if got := a.match(authPath(tc.urlPath)).prefix; got != tc.wantPrefix {
+			t.Errorf("rule for %q has prefix %q, want %q", tc.urlPath, got, tc.wantPrefix)
+		}
+	}
+}
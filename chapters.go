@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frou/stdext"
+)
+
+// Many vids' descriptions list chapters as lines like "00:00 Intro". These are
+// parsed (following the rules YouTube itself uses: the first must start at
+// zero, there must be at least three, and they must be in order) and written
+// to a companion file in the Podcasting 2.0 JSON chapters format. Optionally,
+// they're also embedded into the episode file itself (as ID3 CHAP/CTOC frames
+// for MP3, chapter atoms for MP4, etc.) using ffmpeg.
+//
+// REF: https://support.google.com/youtube/answer/9884579
+// REF: https://github.com/Podcastindex-org/podcast-namespace/blob/main/docs/examples/chapters/jsonChapters.md
+
+const (
+	chaptersMinCount       = 3
+	chaptersFormatVersion  = "1.2.0"
+	chaptersEmbedCommand   = "ffmpeg"
+	chaptersEmbeddingInfix = ".chaptered"
+)
+
+type chapter struct {
+	start time.Duration
+	title string
+}
+
+// e.g. "00:00 Intro", "1:02:03 - Topic", "(12:34) Topic" or "• 5:00 | Topic"
+var chapterLineFormat = regexp.MustCompile(
+	`^\s*(?:[-•*▶►]\s*)?[\[(]?((?:\d{1,2}:)?\d{1,2}:\d{2})[\])]?\s*(?:[-–—:|.]\s*)?(\S.*?)\s*$`)
+
+// Returns nil if desc doesn't list chapters.
+func parseChapters(desc string) []chapter {
+	var chapters []chapter
+	for _, line := range strings.Split(desc, "\n") {
+		m := chapterLineFormat.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		start, err := parseChapterTimestamp(m[1])
+		if err != nil {
+			continue
+		}
+		if len(chapters) > 0 && start <= chapters[len(chapters)-1].start {
+			// Out of order, so probably not a chapter (e.g. a timestamp
+			// mentioned in a later paragraph).
+			continue
+		}
+		chapters = append(chapters, chapter{start: start, title: m[2]})
+	}
+	if len(chapters) < chaptersMinCount || chapters[0].start != 0 {
+		return nil
+	}
+	return chapters
+}
+
+// e.g. "1:02:03" or "02:03"
+func parseChapterTimestamp(s string) (time.Duration, error) {
+	var d time.Duration
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, err
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second, nil
+}
+
+// ------------------------------------------------------------
+
+type chaptersFile struct {
+	Version  string             `json:"version"`
+	Chapters []chaptersFileItem `json:"chapters"`
+}
+
+type chaptersFileItem struct {
+	StartTime float64 `json:"startTime"`
+	Title     string  `json:"title"`
+}
+
+// Write vi's chapters to its companion file, or remove that file if it has
+// none. Returns whether the file changed.
+func (vi *ytVidInfo) writeChaptersFile(chapters []chapter) (bool, error) {
+	path := vi.chaptersPath()
+	if len(chapters) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	cf := chaptersFile{Version: chaptersFormatVersion}
+	for _, c := range chapters {
+		cf.Chapters = append(cf.Chapters, chaptersFileItem{StartTime: c.start.Seconds(), Title: c.title})
+	}
+	buf, err := json.MarshalIndent(cf, "", "\t")
+	if err != nil {
+		return false, err
+	}
+	if existing, err := os.ReadFile(path); err == nil && string(existing) == string(buf) {
+		return false, nil
+	}
+	return true, writeFileAtomically(path, buf)
+}
+
+// Write the chapters files of the known vids that have been downloaded, in
+// case they were downloaded before chapters were supported. Only the watch
+// goroutine calls this.
+func (w *watcher) writeMissingChaptersFiles() {
+	var changed bool
+	for i := range w.vids {
+		vi := &w.vids[i]
+		if _, err := os.Stat(vi.episodePath(w.fileExtension())); err != nil {
+			continue
+		}
+		if _, err := os.Stat(vi.chaptersPath()); err == nil {
+			continue
+		}
+		wrote, err := vi.writeChaptersFile(parseChapters(vi.desc))
+		if err != nil {
+			log.Printf("%s: Writing chapters of %s failed: %v", w.pod, vi.id, err)
+		}
+		changed = changed || wrote
+	}
+	if changed {
+		w.mu.Lock()
+		w.feedOutdated = true
+		w.mu.Unlock()
+	}
+}
+
+// Embed chapters into the media file at path, which is of the format implied
+// by fileExt and lasts for duration (zero if unknown).
+func embedChapters(ctx context.Context, path, fileExt string, chapters []chapter, duration time.Duration) error {
+	if duration == 0 {
+		var err error
+		if duration, err = probeDuration(ctx, path); err != nil {
+			return err
+		}
+	}
+
+	// REF: https://ffmpeg.org/ffmpeg-formats.html#Metadata-1
+	var meta strings.Builder
+	meta.WriteString(";FFMETADATA1\n")
+	for i, c := range chapters {
+		end := duration
+		if i+1 < len(chapters) {
+			end = chapters[i+1].start
+		}
+		fmt.Fprintf(&meta, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			c.start.Milliseconds(), end.Milliseconds(), ffmetadataEscaper.Replace(c.title))
+	}
+	base := strings.TrimSuffix(path, "."+fileExt) + chaptersEmbeddingInfix
+	metaPath, outPath := base+".txt", base+"."+fileExt
+	defer os.Remove(metaPath)
+	if err := os.WriteFile(metaPath, []byte(meta.String()), stdext.OwnerWritableReg); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, chaptersEmbedCommand,
+		"-v", "error", "-y",
+		"-i", path, "-i", metaPath,
+		"-map", "0", "-map_metadata", "0", "-map_chapters", "1",
+		"-codec", "copy",
+		outPath)
+	cmd.WaitDelay = downloaderWaitDelay
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outPath)
+		return fmt.Errorf("%s: %w: %s", chaptersEmbedCommand, err, strings.TrimSpace(string(out)))
+	}
+	return os.Rename(outPath, path)
+}
+
+var ffmetadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
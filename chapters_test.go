@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseChapters(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		desc string
+		want []chapter
+	}{
+		{
+			name: "typical",
+			desc: "In this episode...\n\n00:00 Intro\n01:30 - The news\n12:05 Interview\n1:02:03 Outro\n\nFollow us!",
+			want: []chapter{
+				{0, "Intro"},
+				{90 * time.Second, "The news"},
+				{12*time.Minute + 5*time.Second, "Interview"},
+				{time.Hour + 2*time.Minute + 3*time.Second, "Outro"},
+			},
+		},
+		{
+			name: "decorated",
+			desc: "(0:00) Start\n• 5:00 | Middle\n[10:00] End",
+			want: []chapter{{0, "Start"}, {5 * time.Minute, "Middle"}, {10 * time.Minute, "End"}},
+		},
+		{
+			name: "out of order timestamps ignored",
+			desc: "0:00 A\n2:00 B\n1:00 mentioned later\n3:00 C",
+			want: []chapter{{0, "A"}, {2 * time.Minute, "B"}, {3 * time.Minute, "C"}},
+		},
+		{
+			name: "first doesn't start at zero",
+			desc: "0:10 A\n2:00 B\n3:00 C",
+		},
+		{
+			name: "too few",
+			desc: "0:00 A\n2:00 B",
+		},
+		{
+			name: "no timestamps",
+			desc: "Just a description.",
+		},
+		{
+			name: "invalid timestamp",
+			desc: "0:00 A\n99:9 B\n2:00 C",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseChapters(tc.desc); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// As well as its episode file, a vid can have companion files in the metadata
+// directory, named after its ID:
+//
+//   - ID.chapters.json: its chapters, in the Podcasting 2.0 JSON format.
+//   - ID.LANG.vtt, ID.LANG.srt and ID.LANG.txt: a transcript of it in the
+//     language LANG, as WebVTT, SubRip, and plain text.
+//
+// The feed links to whichever of them exist.
+
+const chaptersFileSuffix = ".chapters.json"
+
+type transcriptFormat struct {
+	ext      string
+	mimeType string
+	// Whether the transcript is timed, so can be shown as captions.
+	captions bool
+}
+
+// In order of preference.
+//
+//nolint:gochecknoglobals
+var transcriptFormats = []transcriptFormat{
+	{"vtt", "text/vtt", true},
+	{"srt", "application/srt", true},
+	{"txt", "text/plain", false},
+}
+
+type companionFile struct {
+	path string
+	// Only set for transcripts.
+	format *transcriptFormat
+	lang   string
+}
+
+func (cf *companionFile) isChapters() bool {
+	return strings.HasSuffix(cf.path, chaptersFileSuffix)
+}
+
+func (vi *ytVidInfo) chaptersPath() string {
+	return filepath.Join(dataSubdirMetadata, vi.id+chaptersFileSuffix)
+}
+
+func (vi *ytVidInfo) transcriptPath(lang, fileExt string) string {
+	return filepath.Join(dataSubdirMetadata, fmt.Sprint(vi.id, ".", lang, ".", fileExt))
+}
+
+// Returns the companion files in the metadata directory, keyed by the ID of
+// the vid they belong to. Transcripts are ordered by transcriptFormats.
+func readCompanionFiles() (map[string][]companionFile, error) {
+	entries, err := os.ReadDir(dataSubdirMetadata)
+	if err != nil {
+		return nil, err
+	}
+	companions := make(map[string][]companionFile)
+	for _, entry := range entries {
+		name := entry.Name()
+		if id, ok := strings.CutSuffix(name, chaptersFileSuffix); ok {
+			companions[id] = append(companions[id], companionFile{path: filepath.Join(dataSubdirMetadata, name)})
+		}
+	}
+	for i := range transcriptFormats {
+		format := &transcriptFormats[i]
+		for _, entry := range entries {
+			name := entry.Name()
+			rest, ok := strings.CutSuffix(name, "."+format.ext)
+			if !ok {
+				continue
+			}
+			id, lang, ok := strings.Cut(rest, ".")
+			if !ok || lang == "" || strings.Contains(lang, ".") {
+				continue
+			}
+			companions[id] = append(companions[id], companionFile{
+				path:   filepath.Join(dataSubdirMetadata, name),
+				format: format,
+				lang:   lang,
+			})
+		}
+	}
+	return companions, nil
+}
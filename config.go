@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os/exec"
 	"path/filepath"
 	"reflect"
@@ -25,24 +27,56 @@ type config struct {
 	ServeDirectoryListings bool      `json:"serve_directory_listings" validate:"-"`
 	LinkProxy              string    `json:"link_proxy"               validate:"omitempty,uri"`
 	DownloaderName         string    `json:"downloader_name"          validate:"-"`
+	Discovery              string    `json:"discovery"                validate:"omitempty,oneof=search playlist feed"`
+	YTFeedBaseURL          string    `json:"yt_feed_base_url"         validate:"omitempty,url"`
+
+	// HTTPS-related
+	TLSCertFile      string `json:"tls_cert_file"      validate:"required_with=TLSKeyFile"`
+	TLSKeyFile       string `json:"tls_key_file"       validate:"required_with=TLSCertFile"`
+	TLSACME          bool   `json:"tls_acme"           validate:"-"`
+	TLSACMECacheDir  string `json:"tls_acme_cache_dir" validate:"required_if=TLSACME true"`
+	TLSACMEEmail     string `json:"tls_acme_email"     validate:"omitempty,email"`
+	HTTPRedirectPort int    `json:"http_redirect_port" validate:"omitempty,min=1,max=65535,nefield=ServePort"`
+
+	// If nil, requests aren't restricted.
+	Auth *authConfig `json:"auth" validate:"omitempty"`
+
+	// Health-related. If zero, defaults are used.
+	HealthDiskLowMB         int                 `json:"health_disk_low_mb"         validate:"omitempty,min=1"`
+	HealthDownloaderOldDays int                 `json:"health_downloader_old_days" validate:"omitempty,min=1"`
+	HealthFeedsStaleDays    int                 `json:"health_feeds_stale_days"    validate:"omitempty,min=1"`
+	HealthMaxGivenUpVids    int                 `json:"health_max_given_up_vids"   validate:"omitempty,min=1"`
+	HealthChecks            []customHealthCheck `json:"health_checks"              validate:"dive"`
 
 	// Watcher-related
 	CheckIntervalMinutes int    `json:"check_interval_minutes"  validate:"min=1"`
+	DownloadWorkers      int    `json:"download_workers"        validate:"omitempty,min=1"`
+	DownloadTimeoutMins  int    `json:"download_timeout_minutes" validate:"omitempty,min=1"`
 	YTDLFmtSelector      string `json:"ytdl_fmt_selector"       validate:"required"`
 	YTDLWriteExt         string `json:"ytdl_write_ext"          validate:"alphanum"`
 	YTDLVideoFmtSelector string `json:"ytdl_video_fmt_selector" validate:"required"`
 	YTDLVideoWriteExt    string `json:"ytdl_video_write_ext"    validate:"alphanum"`
+	VerifyEpisodes       bool   `json:"verify_episodes"         validate:"-"`
 }
 
 // ------------------------------------------------------------
 
 type podcast struct {
-	YTChannelHandle       string `json:"yt_channel" validate:"required"`
-	YTChannelHandleFormat channelHandleFormat
-	YTChannelID           string
-	YTChannelReadableName string
+	// A podcast is based on either a single channel, several channels, or a
+	// playlist. A single channel specified by yt_channel is normalised to be
+	// the sole element of YTChannels.
+	YTChannelHandle string          `json:"yt_channel"  validate:"-"`
+	YTChannels      []channelSource `json:"yt_channels" validate:"omitempty,dive"`
 
-	Name        string `json:"name"        validate:"required"`
+	YTPlaylist            string `json:"yt_playlist"    validate:"-"`
+	YTPlaylistTitle       string
+	YTPlaylistDescription string
+	YTPlaylistOwner       string
+	YTPlaylistOwnerID     string
+	PlaylistOrder         string `json:"playlist_order" validate:"omitempty,oneof=published playlist"`
+
+	// For a playlist, Name defaults to the playlist's title.
+	Name        string `json:"name"        validate:"required_without=YTPlaylist"`
 	ShortName   string `json:"short_name"  validate:"required"`
 	Description string `json:"description" validate:"-"`
 
@@ -55,6 +89,82 @@ type podcast struct {
 
 	Video           bool   `json:"video" validate:"-"`
 	CustomImagePath string `json:"custom_image" validate:"-"`
+
+	// Whether chapters listed in vids' descriptions are embedded into episode
+	// files, as well as being written to companion files.
+	EmbedChapters bool `json:"embed_chapters" validate:"-"`
+
+	// If any, episodes' captions are fetched in the first of these languages
+	// that has them.
+	SubtitleLangs []string `json:"subtitle_langs" validate:"dive,required,excludesall=./"`
+
+	// iTunes-specific metadata. The category is in the form "Category" or
+	// "Category > Subcategory". The owner is only included if there's an
+	// email address, and their name defaults to the podcast's author.
+	ItunesCategory   string `json:"itunes_category"    validate:"-"`
+	ItunesOwnerName  string `json:"itunes_owner_name"  validate:"-"`
+	ItunesOwnerEmail string `json:"itunes_owner_email" validate:"omitempty,email"`
+	Explicit         bool   `json:"explicit"           validate:"-"`
+
+	// Podcasting 2.0 namespace. If PodcastGUID is empty, it's derived from
+	// the feed's URL.
+	PodcastNamespace bool            `json:"podcast_namespace" validate:"-"`
+	PodcastGUID      string          `json:"podcast_guid"      validate:"omitempty,uuid"`
+	PodcastLocked    bool            `json:"podcast_locked"    validate:"-"`
+	Persons          []podcastPerson `json:"persons"           validate:"dive"`
+
+	// Whether episodes published with URL-based GUIDs (by older versions)
+	// keep them, rather than switching to ones derived from their vids' IDs.
+	// If nil, they do.
+	LegacyGUIDs *bool `json:"legacy_guids" validate:"-"`
+
+	// If zero, the number is only limited by the top-level config's
+	// DownloadWorkers.
+	MaxConcurrentDownloads int `json:"max_concurrent_downloads" validate:"omitempty,min=1"`
+
+	// If empty, the top-level config's value is used.
+	Discovery string `json:"discovery" validate:"omitempty,oneof=search playlist feed"`
+
+	// If either is set, the podcast is private. Tokens are keyed by
+	// subscriber name.
+	AccessTokens     map[string]string `json:"access_tokens"      validate:"-"`
+	AccessTokensFile string            `json:"access_tokens_file" validate:"-"`
+
+	// Thresholds for the podcast's health checks. If zero, defaults are used.
+	HealthStaleDays        int `json:"health_stale_days"         validate:"omitempty,min=1"`
+	HealthMaxProblemVids   int `json:"health_max_problem_vids"   validate:"omitempty,min=1"`
+	HealthMaxCheckFailures int `json:"health_max_check_failures" validate:"omitempty,min=1"`
+}
+
+// One of the channels that a podcast is based on.
+type channelSource struct {
+	YTChannelHandle       string `json:"yt_channel" validate:"required"`
+	YTChannelHandleFormat channelHandleFormat
+	YTChannelID           string
+	YTChannelReadableName string
+	YTUploadsPlaylistID   string
+
+	// If empty, the podcast's title filter is used.
+	TitleFilter          string `json:"title_filter" validate:"-"`
+	TitleFilterIsLiteral bool
+	TitleFilterRE        *regexp.Regexp
+}
+
+func (src *channelSource) String() string {
+	return src.YTChannelHandle
+}
+
+func (src *channelSource) homeLink() string {
+	switch src.YTChannelHandleFormat {
+	case ChannelID:
+		return youtubeChannelUrlPrefix + src.YTChannelHandle
+	case Handle:
+		return youtubeHandleUrlPrefix + src.YTChannelHandle
+	case CustomURL:
+		return youtubeCustomUrlPrefix + src.YTChannelHandle
+	default:
+		return youtubeUserUrlPrefix + src.YTChannelHandle
+	}
 }
 
 func (p *podcast) feedPath() string {
@@ -69,6 +179,66 @@ func (p *podcast) String() string {
 	return p.ShortName
 }
 
+// e.g. "A", "A and B", "A, B and C"
+func (p *podcast) channelsReadableName() string {
+	names := make([]string, len(p.YTChannels))
+	for i := range p.YTChannels {
+		names[i] = p.YTChannels[i].YTChannelReadableName
+	}
+	if len(names) <= 1 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// Summarise the parts of the config that determine which vids are of interest.
+func (p *podcast) sourcesSignature() []string {
+	if p.YTPlaylist != "" {
+		return []string{"playlist:" + p.YTPlaylist}
+	}
+	sig := make([]string, len(p.YTChannels))
+	for i, src := range p.YTChannels {
+		sig[i] = fmt.Sprintf("channel:%s:%s", src.YTChannelHandle, src.TitleFilter)
+	}
+	return sig
+}
+
+// The paths of files that must not be served or cleaned, and so must be
+// outside the data directory.
+func (c *config) secretPaths() []string {
+	var paths []string
+	for _, path := range []string{c.TLSKeyFile, c.TLSACMECacheDir} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	for i := range c.Podcasts {
+		if path := c.Podcasts[i].AccessTokensFile; path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Returns an error if any of the secrets are within dir.
+func (c *config) checkSecretsOutside(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	for _, path := range c.secretPaths() {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, absPath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s is inside the data directory, so would be served publicly", path)
+		}
+	}
+	return nil
+}
+
 // ------------------------------------------------------------
 
 type channelHandleFormat int
@@ -77,14 +247,26 @@ type channelHandleFormat int
 const (
 	LegacyUsername channelHandleFormat = iota
 	ChannelID
-	// @todo Support "Custom URL" channel identifiers in addition to Channel-IDs and Usernames
-	// @body https://stackoverflow.com/questions/37267324/how-to-get-youtube-channel-details-using-youtube-data-api-if-channel-has-custom
-	// @body https://github.com/mattwright324/youtube-metadata/issues/1
-	// @body https://stackoverflow.com/questions/68490562/youtube-channel-with-custom-url-but-no-c-slug-in-url-does-not-return-snippet
-	//CustomUrl
-	// @todo Yet another possibility has been introduced: @handles
-	// @body https://support.google.com/youtube/answer/6180214
-	// @body https://support.google.com/youtube/answer/11585688
+	// REF: https://support.google.com/youtube/answer/11585688
+	Handle
+	// Custom URLs have no direct lookup in the API, so they're resolved on a
+	// best-effort basis.
+	// REF: https://stackoverflow.com/questions/37267324/how-to-get-youtube-channel-details-using-youtube-data-api-if-channel-has-custom
+	CustomURL
+)
+
+// How a watcher finds out about vids published to its channel.
+const (
+	// Use the API's Search.List, which costs 100 quota units per page of
+	// results, but allows for (fuzzy) server-side title filtering.
+	discoverySearch = "search"
+	// Use the API's PlaylistItems.List on the channel's uploads playlist,
+	// which costs only 1 quota unit per page of results.
+	discoveryPlaylist = "playlist"
+	// Poll the channel's public Atom feed, which costs no quota units, but
+	// only lists recent vids. The API is still used (as with
+	// discoveryPlaylist) for the initial backfill or if the feed fails.
+	discoveryFeed = "feed"
 )
 
 const (
@@ -92,7 +274,16 @@ const (
 
 	youtubeChannelUrlPrefix = youtubeHomeUrl + "/channel/"
 	youtubeUserUrlPrefix    = youtubeHomeUrl + "/user/"
-	// youtubeCustomUrlPrefix  = youtubeHomeUrl + "/c/"
+	youtubeHandleUrlPrefix  = youtubeHomeUrl + "/@"
+	youtubeCustomUrlPrefix  = youtubeHomeUrl + "/c/"
+
+	youtubePlaylistUrlPrefix = youtubeHomeUrl + "/playlist?list="
+)
+
+// How the episodes of a podcast based on a playlist are ordered.
+const (
+	playlistOrderPublished = "published"
+	playlistOrderPlaylist  = "playlist"
 )
 
 // ------------------------------------------------------------
@@ -113,45 +304,110 @@ func loadConfig(path string) (c *config, err error) {
 		return nil, err
 	}
 
+	if c.TLSACME && c.TLSCertFile != "" {
+		return nil, errors.New("tls_acme and tls_cert_file are mutually exclusive")
+	}
+	if c.HTTPRedirectPort != 0 && !c.tlsEnabled() {
+		return nil, errors.New("http_redirect_port requires TLS to be configured")
+	}
+	if c.Discovery == "" {
+		c.Discovery = discoverySearch
+	}
+	if c.YTFeedBaseURL == "" {
+		c.YTFeedBaseURL = ytFeedDefaultBaseURL
+	}
+	if c.DownloadWorkers == 0 {
+		c.DownloadWorkers = defaultDownloadWorkers
+	}
+	if c.HealthDiskLowMB == 0 {
+		c.HealthDiskLowMB = defaultDiskLowMB
+	}
+	if c.HealthDownloaderOldDays == 0 {
+		c.HealthDownloaderOldDays = defaultDownloaderOldDays
+	}
+	if c.HealthFeedsStaleDays == 0 {
+		c.HealthFeedsStaleDays = defaultFeedsStaleDays
+	}
+	if c.HealthMaxGivenUpVids == 0 {
+		c.HealthMaxGivenUpVids = defaultMaxGivenUpVids
+	}
+	healthCheckNames := mapset.New[string]()
+	for _, hc := range c.HealthChecks {
+		if _, builtin := healthConcerns[hc.Name]; builtin || healthCheckNames.Has(hc.Name) {
+			return nil, fmt.Errorf("health check name %q is used more than once", hc.Name)
+		}
+		healthCheckNames.Put(hc.Name)
+	}
+
 	for i := range c.Podcasts {
-		handle := c.Podcasts[i].YTChannelHandle
+		pod := &c.Podcasts[i]
+		if pod.Discovery == "" {
+			pod.Discovery = c.Discovery
+		}
+
+		if pod.HealthStaleDays == 0 {
+			pod.HealthStaleDays = c.HealthFeedsStaleDays
+		}
+		if pod.HealthMaxProblemVids == 0 {
+			pod.HealthMaxProblemVids = defaultHealthMaxProblemVids
+		}
+		if pod.HealthMaxCheckFailures == 0 {
+			pod.HealthMaxCheckFailures = defaultHealthMaxCheckFailures
+		}
+		if err := pod.checkAccessTokens(); err != nil {
+			return nil, err
+		}
+
 		switch {
-		case strings.HasPrefix(handle, youtubeUserUrlPrefix):
-			c.Podcasts[i].YTChannelHandle = strings.TrimPrefix(handle, youtubeUserUrlPrefix)
-			c.Podcasts[i].YTChannelHandleFormat = LegacyUsername
-		case strings.HasPrefix(handle, youtubeChannelUrlPrefix) || ytChannelIDFormat.MatchString(handle):
-			c.Podcasts[i].YTChannelHandle = strings.TrimPrefix(handle, youtubeChannelUrlPrefix)
-			c.Podcasts[i].YTChannelHandleFormat = ChannelID
-		// case strings.HasPrefix(handle, youtubeCustomUrlPrefix):
-		// 	c.Podcasts[i].YTChannelHandle = strings.TrimPrefix(handle, youtubeCustomUrlPrefix)
-		// 	c.Podcasts[i].YTChannelHandleFormat = CustomUrl
+		case pod.YTPlaylist != "" && pod.YTChannelHandle == "" && len(pod.YTChannels) == 0:
+			id, err := parsePlaylistID(pod.YTPlaylist)
+			if err != nil {
+				return nil, err
+			}
+			pod.YTPlaylist = id
+			if pod.PlaylistOrder == "" {
+				pod.PlaylistOrder = playlistOrderPublished
+			}
+		case pod.YTPlaylist == "" && pod.YTChannelHandle != "" && len(pod.YTChannels) == 0:
+			pod.YTChannels = []channelSource{{YTChannelHandle: pod.YTChannelHandle}}
+		case pod.YTPlaylist == "" && pod.YTChannelHandle == "" && len(pod.YTChannels) > 0:
+			// Already in normal form.
 		default:
-			log.Printf("Assuming that channel handle %q in config is a legacy YouTube username", handle)
-			c.Podcasts[i].YTChannelHandleFormat = LegacyUsername
+			return nil, fmt.Errorf("podcast %q must specify exactly one of yt_channel, yt_channels or yt_playlist", pod.ShortName)
+		}
+		for j := range pod.YTChannels {
+			pod.YTChannels[j].parseHandle()
 		}
 
 		// Parse Epoch
 		var t time.Time
 		var err error
-		if es := c.Podcasts[i].EpochStr; es != "" {
+		if es := pod.EpochStr; es != "" {
 			t, err = time.Parse("2006-01-02", es)
 			if err != nil {
 				return nil, err
 			}
 		}
-		c.Podcasts[i].Epoch = t
+		pod.Epoch = t
 
-		// Parse Title Filter
-		re, err := regexp.Compile(c.Podcasts[i].TitleFilter)
+		// Parse Title Filters
+		pod.TitleFilterRE, pod.TitleFilterIsLiteral, err = compileTitleFilter(pod.TitleFilter)
 		if err != nil {
-			return nil, fmt.Errorf("error in regex specified for title filter: %w", err)
+			return nil, err
 		}
-		_, c.Podcasts[i].TitleFilterIsLiteral = re.LiteralPrefix()
-		if !c.Podcasts[i].TitleFilterIsLiteral {
-			log.Printf("Warning: title filter for %q contains regexp metacharacters so may cause high YouTube API quota usage", c.Podcasts[i].Name)
+		for j := range pod.YTChannels {
+			src := &pod.YTChannels[j]
+			if src.TitleFilter == "" {
+				src.TitleFilter = pod.TitleFilter
+			}
+			src.TitleFilterRE, src.TitleFilterIsLiteral, err = compileTitleFilter(src.TitleFilter)
+			if err != nil {
+				return nil, err
+			}
+			if !src.TitleFilterIsLiteral && pod.Discovery == discoverySearch {
+				log.Printf("Warning: title filter for %q contains regexp metacharacters so may cause high YouTube API quota usage", pod.ShortName)
+			}
 		}
-		// Force case-insensitive matching.
-		c.Podcasts[i].TitleFilterRE = regexp.MustCompile(fmt.Sprintf("(?i:%s)", re.String()))
 	}
 
 	// Listed in descending priority
@@ -177,6 +433,56 @@ func loadConfig(path string) (c *config, err error) {
 	return c, err
 }
 
+func (src *channelSource) parseHandle() {
+	handle := strings.TrimSuffix(src.YTChannelHandle, "/")
+	switch {
+	case strings.HasPrefix(handle, youtubeUserUrlPrefix):
+		src.YTChannelHandle = strings.TrimPrefix(handle, youtubeUserUrlPrefix)
+		src.YTChannelHandleFormat = LegacyUsername
+	// Checked before channel IDs, because a handle could look like one.
+	case strings.HasPrefix(handle, youtubeHandleUrlPrefix) || strings.HasPrefix(handle, "@"):
+		src.YTChannelHandle = strings.TrimPrefix(strings.TrimPrefix(handle, youtubeHandleUrlPrefix), "@")
+		src.YTChannelHandleFormat = Handle
+	case strings.HasPrefix(handle, youtubeChannelUrlPrefix) || ytChannelIDFormat.MatchString(handle):
+		src.YTChannelHandle = strings.TrimPrefix(handle, youtubeChannelUrlPrefix)
+		src.YTChannelHandleFormat = ChannelID
+	case strings.HasPrefix(handle, youtubeCustomUrlPrefix):
+		src.YTChannelHandle = strings.TrimPrefix(handle, youtubeCustomUrlPrefix)
+		src.YTChannelHandleFormat = CustomURL
+	default:
+		log.Printf("Assuming that channel handle %q in config is a legacy YouTube username", handle)
+		src.YTChannelHandleFormat = LegacyUsername
+	}
+}
+
+// The returned regexp always matches case-insensitively.
+func compileTitleFilter(filter string) (re *regexp.Regexp, isLiteral bool, err error) {
+	re, err = regexp.Compile(filter)
+	if err != nil {
+		return nil, false, fmt.Errorf("error in regex specified for title filter: %w", err)
+	}
+	_, isLiteral = re.LiteralPrefix()
+	// Force case-insensitive matching.
+	return regexp.MustCompile(fmt.Sprintf("(?i:%s)", re.String())), isLiteral, nil
+}
+
+// Accept either a bare playlist ID, or the URL of a page that has one in its
+// query string (e.g. https://www.youtube.com/playlist?list=PL...).
+func parsePlaylistID(s string) (string, error) {
+	if !strings.Contains(s, "list=") {
+		return s, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("error in playlist URL: %w", err)
+	}
+	id := u.Query().Get("list")
+	if id == "" {
+		return "", fmt.Errorf("playlist URL %q does not contain a playlist ID", s)
+	}
+	return id, nil
+}
+
 func initValidator() *validator.Validate {
 	validate := validator.New()
 
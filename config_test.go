@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestChannelSourceParseHandle(t *testing.T) {
+	for _, tc := range []struct {
+		in, handle string
+		format     channelHandleFormat
+	}{
+		{"UCabcdefghijklmnopqrstuv", "UCabcdefghijklmnopqrstuv", ChannelID},
+		{"https://www.youtube.com/channel/UCabcdefghijklmnopqrstuv/", "UCabcdefghijklmnopqrstuv", ChannelID},
+		{"@SomeCreator", "SomeCreator", Handle},
+		{"https://www.youtube.com/@SomeCreator", "SomeCreator", Handle},
+		// Handles that contain something that looks like a channel ID.
+		{"@UCabcdefghijklmnopqrstuv", "UCabcdefghijklmnopqrstuv", Handle},
+		{"@xUCabcdefghijklmnopqrstuvx", "xUCabcdefghijklmnopqrstuvx", Handle},
+		{"https://www.youtube.com/c/SomeCreator", "SomeCreator", CustomURL},
+		{"https://www.youtube.com/user/someuser", "someuser", LegacyUsername},
+		{"someuser", "someuser", LegacyUsername},
+		{"xUCabcdefghijklmnopqrstuv", "xUCabcdefghijklmnopqrstuv", LegacyUsername},
+	} {
+		src := channelSource{YTChannelHandle: tc.in}
+		src.parseHandle()
+		if src.YTChannelHandle != tc.handle || src.YTChannelHandleFormat != tc.format {
+			t.Errorf("%q parsed as (%q, %d), want (%q, %d)",
+				tc.in, src.YTChannelHandle, src.YTChannelHandleFormat, tc.handle, tc.format)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/frou/yt2pod/internal/xplatform"
+)
+
+// Extra health checks can be defined in the config file. Each either runs a
+// shell command, which is a concern if it exits non-zero, or probes a URL,
+// which is a concern if the response's status code isn't 2xx/3xx.
+
+type customHealthCheck struct {
+	Name        string `json:"name"            validate:"required,excludesall=/ "`
+	Command     string `json:"command"         validate:"required_without=URL,excluded_with=URL"`
+	URL         string `json:"url"             validate:"required_without=Command,omitempty,url"`
+	TimeoutSecs int    `json:"timeout_seconds" validate:"omitempty,min=1"`
+}
+
+// How much of a failing command's output is reported.
+const customHealthMaxOutput = 512
+
+func (hc *customHealthCheck) run() (healthResult, error) {
+	timeout := defaultCustomHealthTimeout
+	if hc.TimeoutSecs > 0 {
+		timeout = time.Duration(hc.TimeoutSecs) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if hc.Command != "" {
+		return hc.runCommand(ctx)
+	}
+	return hc.probeURL(ctx)
+}
+
+func (hc *customHealthCheck) runCommand(ctx context.Context) (healthResult, error) {
+	res := healthResult{unit: "exit status"}
+	cmd := xplatform.ShellCommand(ctx, hc.Command)
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return res, fmt.Errorf("running %q: %w", hc.Command, ctxErr)
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return res, fmt.Errorf("running %q: %w", hc.Command, err)
+		}
+		res.value = float64(exitErr.ExitCode())
+		res.concern = true
+		res.reason = strings.TrimSpace(string(output[:min(len(output), customHealthMaxOutput)]))
+	}
+	return res, nil
+}
+
+func (hc *customHealthCheck) probeURL(ctx context.Context) (healthResult, error) {
+	res := healthResult{threshold: http.StatusBadRequest, unit: "HTTP status"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.URL, nil)
+	if err != nil {
+		return res, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	res.value = float64(resp.StatusCode)
+	if resp.StatusCode >= http.StatusBadRequest {
+		res.concern = true
+		res.reason = resp.Status
+	}
+	return res, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCustomHealthCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands are written for a Unix shell")
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name        string
+		hc          customHealthCheck
+		wantErr     bool
+		wantConcern bool
+		wantValue   float64
+		wantReason  string
+	}{
+		{"command succeeds", customHealthCheck{Command: "true"}, false, false, 0, ""},
+		{"command fails", customHealthCheck{Command: "echo backups are stale; exit 3"}, false, true, 3, "backups are stale"},
+		{"command times out", customHealthCheck{Command: "sleep 5", TimeoutSecs: 1}, true, false, 0, ""},
+		{"URL up", customHealthCheck{URL: srv.URL + "/up"}, false, false, http.StatusOK, ""},
+		{"URL down", customHealthCheck{URL: srv.URL + "/down"}, false, true, http.StatusServiceUnavailable, "503 Service Unavailable"},
+		{"URL unreachable", customHealthCheck{URL: "http://127.0.0.1:1/"}, true, false, 0, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.hc.run()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tc.wantErr)
+			}
+			if res.concern != tc.wantConcern || res.value != tc.wantValue || res.reason != tc.wantReason {
+				t.Errorf("got %+v", res)
+			}
+		})
+	}
+}
+
+func TestLoadConfigHealth(t *testing.T) {
+	const base = `{
+		"yt_data_api_key": "key",
+		"check_interval_minutes": 15,
+		"ytdl_fmt_selector": "140",
+		"ytdl_write_ext": "m4a",
+		"ytdl_video_fmt_selector": "18",
+		"ytdl_video_write_ext": "mp4",
+		"downloader_name": "yt-dlp",
+		"serve_host": "example.com",
+		"serve_port": 80,
+		%s
+		"podcasts": [{"name": "Example", "short_name": "example", "yt_channel": "@example" %s}]
+	}`
+	for _, tc := range []struct {
+		name             string
+		top, pod         string
+		wantErr          string
+		wantGivenUp      int
+		wantProblemVids  int
+		wantStaleDays    int
+		wantCheckFailure int
+	}{
+		{name: "defaults", wantGivenUp: defaultMaxGivenUpVids, wantProblemVids: defaultHealthMaxProblemVids,
+			wantStaleDays: defaultFeedsStaleDays, wantCheckFailure: defaultHealthMaxCheckFailures},
+		{name: "configured",
+			top:         `"health_max_given_up_vids": 3, "health_feeds_stale_days": 4,`,
+			pod:         `, "health_max_problem_vids": 5, "health_max_check_failures": 6`,
+			wantGivenUp: 3, wantProblemVids: 5, wantStaleDays: 4, wantCheckFailure: 6},
+		{name: "podcast's stale days",
+			top:         `"health_feeds_stale_days": 4,`,
+			pod:         `, "health_stale_days": 2`,
+			wantGivenUp: defaultMaxGivenUpVids, wantProblemVids: defaultHealthMaxProblemVids,
+			wantStaleDays: 2, wantCheckFailure: defaultHealthMaxCheckFailures},
+		{name: "custom check named like a built-in one",
+			top:     `"health_checks": [{"name": "disk_low", "command": "true"}],`,
+			wantErr: "used more than once"},
+		{name: "custom checks with the same name",
+			top:     `"health_checks": [{"name": "backup", "command": "true"}, {"name": "backup", "url": "http://example.com/"}],`,
+			wantErr: "used more than once"},
+		{name: "custom check with both command and URL",
+			top:     `"health_checks": [{"name": "backup", "command": "true", "url": "http://example.com/"}],`,
+			wantErr: "excluded_with"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(fmt.Sprintf(base, tc.top, tc.pod)), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := loadConfig(path)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod := &cfg.Podcasts[0]
+			if cfg.HealthMaxGivenUpVids != tc.wantGivenUp || pod.HealthMaxProblemVids != tc.wantProblemVids ||
+				pod.HealthStaleDays != tc.wantStaleDays || pod.HealthMaxCheckFailures != tc.wantCheckFailure {
+				t.Errorf("got given up %d, problem vids %d, stale days %d, check failures %d",
+					cfg.HealthMaxGivenUpVids, pod.HealthMaxProblemVids, pod.HealthStaleDays, pod.HealthMaxCheckFailures)
+			}
+		})
+	}
+}
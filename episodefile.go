@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Episodes are downloaded to a partial path and only renamed to their proper
+// path once the download has succeeded, so a file existing at the proper path
+// can be trusted to be complete.
+
+// The downloader may also create intermediate files of its own alongside the
+// partial path, but their names will start with it too. Only those are removed
+// when a download is retried, since the same vid may be being downloaded with
+// another file extension (or having its subtitles fetched) at the same time.
+// Anything else left behind is removed when the daemon next starts.
+const partialEpisodeInfix = ".partial"
+
+func (vi *ytVidInfo) partialEpisodePath(fileExt string) string {
+	return filepath.Join(dataSubdirEpisodes, fmt.Sprint(vi.id, partialEpisodeInfix, ".", fileExt))
+}
+
+func (vi *ytVidInfo) removePartialEpisodeFiles(fileExt string) {
+	matches, _ := filepath.Glob(vi.partialEpisodePath(fileExt) + "*")
+	for _, path := range matches {
+		os.Remove(path)
+	}
+}
+
+// Remove partial episode files left behind by downloads that were interrupted
+// (e.g. by the process being killed).
+func removeStalePartialEpisodes() error {
+	matches, err := filepath.Glob(filepath.Join(dataSubdirEpisodes, "*"+partialEpisodeInfix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	if len(matches) > 0 {
+		log.Printf("Removed %d stale partially downloaded episode files", len(matches))
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+
+// Leading bytes that files of each container format start with, keyed by
+// file extension. For some formats, there are several possibilities.
+//
+//nolint:gochecknoglobals
+var containerSignatures = map[string][]struct {
+	offset int
+	magic  []byte
+}{
+	"m4a":  {{4, []byte("ftyp")}},
+	"mp4":  {{4, []byte("ftyp")}},
+	"m4v":  {{4, []byte("ftyp")}},
+	"mov":  {{4, []byte("ftyp")}},
+	"3gp":  {{4, []byte("ftyp")}},
+	"mp3":  {{0, []byte("ID3")}, {0, []byte{0xFF, 0xFB}}, {0, []byte{0xFF, 0xF3}}, {0, []byte{0xFF, 0xF2}}},
+	"webm": {{0, []byte{0x1A, 0x45, 0xDF, 0xA3}}},
+	"mkv":  {{0, []byte{0x1A, 0x45, 0xDF, 0xA3}}},
+	"ogg":  {{0, []byte("OggS")}},
+	"oga":  {{0, []byte("OggS")}},
+	"opus": {{0, []byte("OggS")}},
+	"flac": {{0, []byte("fLaC")}},
+	"wav":  {{0, []byte("RIFF")}},
+}
+
+// Check that the file at path plausibly is a complete episode. If probe is
+// true, also check that its content starts the way the container format
+// implied by fileExt should.
+func verifyEpisodeFile(path, fileExt string, probe bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%s is empty", path)
+	}
+	if !probe {
+		return nil
+	}
+
+	sigs, known := containerSignatures[strings.ToLower(fileExt)]
+	if !known {
+		return nil
+	}
+	head := make([]byte, 16)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	for _, sig := range sigs {
+		end := sig.offset + len(sig.magic)
+		if end <= len(head) && bytes.Equal(head[sig.offset:end], sig.magic) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s does not look like a %s file", path, fileExt)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestVerifyEpisodeFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		fileExt string
+		probe   bool
+		wantErr bool
+	}{
+		{"empty", nil, "m4a", false, true},
+		{"non-empty without probing", []byte("garbage"), "m4a", false, false},
+		{"mp4 family", []byte("\x00\x00\x00\x20ftypM4A \x00\x00"), "m4a", true, false},
+		{"mp3 with ID3 tag", []byte("ID3\x04\x00"), "mp3", true, false},
+		{"mp3 frame sync", []byte{0xFF, 0xFB, 0x90, 0x64}, "MP3", true, false},
+		{"webm", []byte{0x1A, 0x45, 0xDF, 0xA3, 0x01}, "webm", true, false},
+		{"html error page", []byte("<!DOCTYPE html><html>"), "m4a", true, true},
+		{"too short for signature", []byte("ftyp"), "mp4", true, true},
+		{"unknown format", []byte("anything"), "xyz", true, false},
+	} {
+		path := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(path, tc.content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := verifyEpisodeFile(path, tc.fileExt, tc.probe)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+	}
+	if err := verifyEpisodeFile(filepath.Join(dir, "missing"), "m4a", false); err == nil {
+		t.Error("missing: no error")
+	}
+}
+
+func TestRemovePartialEpisodeFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir(dataSubdirEpisodes, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"aaaaaaaaaaa.partial.m4a",
+		"aaaaaaaaaaa.partial.m4a.part",
+		"aaaaaaaaaaa.partial.m4a.ytdl",
+		"aaaaaaaaaaa.partial.mp4",
+		"aaaaaaaaaaa.partial.mp4.part",
+		"aaaaaaaaaaa.partial.subs123",
+		"aaaaaaaaaaa.m4a",
+		"bbbbbbbbbbb.partial.m4a",
+	} {
+		if err := os.WriteFile(filepath.Join(dataSubdirEpisodes, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	(&ytVidInfo{id: "aaaaaaaaaaa"}).removePartialEpisodeFiles("m4a")
+
+	entries, err := os.ReadDir(dataSubdirEpisodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	want := []string{
+		"aaaaaaaaaaa.m4a",
+		"aaaaaaaaaaa.partial.mp4",
+		"aaaaaaaaaaa.partial.mp4.part",
+		"aaaaaaaaaaa.partial.subs123",
+		"bbbbbbbbbbb.partial.m4a",
+	}
+	if !slices.Equal(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
+
+func TestRemoveStalePartialEpisodes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir(dataSubdirEpisodes, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"aaaaaaaaaaa.partial.m4a.part", "bbbbbbbbbbb.partial.mp4", "aaaaaaaaaaa.m4a"} {
+		if err := os.WriteFile(filepath.Join(dataSubdirEpisodes, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := removeStalePartialEpisodes(); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dataSubdirEpisodes, "*"))
+	if want := []string{filepath.Join(dataSubdirEpisodes, "aaaaaaaaaaa.m4a")}; !slices.Equal(matches, want) {
+		t.Errorf("left %v, want %v", matches, want)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The XML of podcast feeds. As well as plain RSS 2.0, it can express the
+// iTunes namespace and the Podcasting 2.0 namespace, which modern podcast
+// clients make use of.
+//
+// REF: https://www.rssboard.org/rss-specification
+// REF: https://podcasters.apple.com/support/823-podcast-requirements
+// REF: https://podcastindex.org/namespace/1.0
+
+const (
+	rssVersion       = "2.0"
+	itunesNamespace  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	podcastNamespace = "https://podcastindex.org/namespace/1.0"
+)
+
+type rssFeed struct {
+	XMLName   xml.Name `xml:"rss"`
+	Version   string   `xml:"version,attr"`
+	ItunesNS  string   `xml:"xmlns:itunes,attr"`
+	PodcastNS string   `xml:"xmlns:podcast,attr,omitempty"`
+	Channel   *rssChannel
+}
+
+type rssChannel struct {
+	XMLName     xml.Name `xml:"channel"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Copyright   string   `xml:"copyright"`
+	Language    string   `xml:"language"`
+	Description string   `xml:"description"`
+
+	ItunesAuthor     string            `xml:"itunes:author,omitempty"`
+	ItunesExplicit   string            `xml:"itunes:explicit"`
+	ItunesSummary    *rssCDATA         `xml:"itunes:summary,omitempty"`
+	ItunesOwner      *itunesOwner      `xml:"itunes:owner,omitempty"`
+	ItunesImage      *itunesImage      `xml:"itunes:image,omitempty"`
+	ItunesCategories []*itunesCategory `xml:"itunes:category,omitempty"`
+
+	PodcastGUID    string            `xml:"podcast:guid,omitempty"`
+	PodcastLocked  *podcastLocked    `xml:"podcast:locked,omitempty"`
+	PodcastFunding []*podcastFunding `xml:"podcast:funding,omitempty"`
+	PodcastPersons []*podcastPerson  `xml:"podcast:person,omitempty"`
+
+	Items []*rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string        `xml:"title"`
+	GUID      *rssGUID      `xml:"guid"`
+	PubDate   rssDate       `xml:"pubDate"`
+	Enclosure *rssEnclosure `xml:"enclosure"`
+
+	ItunesDuration    itunesDuration `xml:"itunes:duration,omitempty"`
+	ItunesExplicit    string         `xml:"itunes:explicit,omitempty"`
+	ItunesOrder       int            `xml:"itunes:order,omitempty"`
+	ItunesSummary     *rssCDATA      `xml:"itunes:summary,omitempty"`
+	ItunesImage       *itunesImage   `xml:"itunes:image,omitempty"`
+	ItunesEpisodeType string         `xml:"itunes:episodeType,omitempty"`
+	ItunesSeason      int            `xml:"itunes:season,omitempty"`
+	ItunesEpisode     int            `xml:"itunes:episode,omitempty"`
+
+	PodcastTranscripts []*podcastTranscript `xml:"podcast:transcript,omitempty"`
+	PodcastChapters    *podcastChapters     `xml:"podcast:chapters,omitempty"`
+}
+
+// Text that may contain HTML, such as links.
+type rssCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+// If IsPermaLink is empty, the GUID is the item's URL.
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr,omitempty"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Formatted as RFC 2822 requires.
+type rssDate time.Time
+
+func (d rssDate) MarshalText() ([]byte, error) {
+	return []byte(time.Time(d).Format(time.RFC1123Z)), nil
+}
+
+// Formatted as H:MM:SS or M:SS. Zero means unknown, and is omitted.
+type itunesDuration time.Duration
+
+func (d itunesDuration) MarshalText() ([]byte, error) {
+	total := int64(time.Duration(d).Round(time.Second).Seconds())
+	hours, minutes, seconds := total/3600, total/60%60, total%60
+	if hours > 0 {
+		return fmt.Appendf(nil, "%d:%02d:%02d", hours, minutes, seconds), nil
+	}
+	return fmt.Appendf(nil, "%d:%02d", minutes, seconds), nil
+}
+
+type itunesOwner struct {
+	Name  string `xml:"itunes:name"`
+	Email string `xml:"itunes:email"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type itunesCategory struct {
+	Text          string            `xml:"text,attr"`
+	Subcategories []*itunesCategory `xml:"itunes:category,omitempty"`
+}
+
+type podcastLocked struct {
+	Owner  string `xml:"owner,attr,omitempty"`
+	Locked string `xml:",chardata"`
+}
+
+type podcastFunding struct {
+	URL  string `xml:"url,attr"`
+	Text string `xml:",chardata"`
+}
+
+// Also used in the config.
+type podcastPerson struct {
+	Name  string `json:"name"  validate:"required"      xml:",chardata"`
+	Role  string `json:"role"  validate:"-"             xml:"role,attr,omitempty"`
+	Group string `json:"group" validate:"-"             xml:"group,attr,omitempty"`
+	Img   string `json:"img"   validate:"omitempty,url" xml:"img,attr,omitempty"`
+	Href  string `json:"href"  validate:"omitempty,url" xml:"href,attr,omitempty"`
+}
+
+type podcastTranscript struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Language string `xml:"language,attr,omitempty"`
+	Rel      string `xml:"rel,attr,omitempty"`
+}
+
+type podcastChapters struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+func newRSSFeed(channel *rssChannel, podcastNS bool) *rssFeed {
+	feed := rssFeed{
+		Version:  rssVersion,
+		ItunesNS: itunesNamespace,
+		Channel:  channel,
+	}
+	if podcastNS {
+		feed.PodcastNS = podcastNamespace
+	}
+	return &feed
+}
+
+func (f *rssFeed) write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	return enc.Close()
+}
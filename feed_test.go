@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestItunesDuration(t *testing.T) {
+	for _, tc := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0:00"},
+		{59 * time.Second, "0:59"},
+		{61*time.Second + 600*time.Millisecond, "1:02"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+		{25 * time.Hour, "25:00:00"},
+	} {
+		got, _ := itunesDuration(tc.d).MarshalText()
+		if string(got) != tc.want {
+			t.Errorf("%v formatted as %q, want %q", tc.d, got, tc.want)
+		}
+	}
+}
+
+func TestPodcastGUID(t *testing.T) {
+	// The example given by the namespace's documentation.
+	if got := podcastGUID("https://mp3s.nashownotes.com/pc20rss.xml"); got != "917393e3-1b1e-5cef-ace4-edaa54e1f810" {
+		t.Errorf("GUID = %s", got)
+	}
+	if podcastGUID("http://example.com/meta/x.xml") != podcastGUID("https://example.com/meta/x.xml/") {
+		t.Error("GUID depends on the URL's scheme or trailing slash")
+	}
+}
+
+func TestWriteFeedPodcastNamespace(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		namespace     bool
+		subtitleLangs []string
+		want, notWant []string
+	}{
+		{
+			name:    "off",
+			notWant: []string{"xmlns:podcast", "<podcast:"},
+		},
+		{
+			name:      "on",
+			namespace: true,
+			want: []string{
+				`xmlns:podcast="https://podcastindex.org/namespace/1.0"`,
+				"<podcast:guid>",
+				`<podcast:locked owner="owner@example.com">yes</podcast:locked>`,
+				`<podcast:funding url="https://www.youtube.com/channel/UCabcdefghijklmnopqrstuv">Support Example Channel on YouTube</podcast:funding>`,
+				`<podcast:person role="host">Ann</podcast:person>`,
+				`<podcast:chapters url="http://new.example.com/meta/aaaaaaaaaaa.chapters.json" type="application/json+chapters">`,
+				`<podcast:transcript url="http://new.example.com/meta/aaaaaaaaaaa.en.vtt" type="text/vtt" language="en" rel="captions">`,
+				`<podcast:transcript url="http://new.example.com/meta/aaaaaaaaaaa.en.txt" type="text/plain" language="en">`,
+			},
+		},
+		{
+			// Transcripts can only be linked to using the namespace, but the
+			// rest of it isn't wanted.
+			name:          "only for transcripts",
+			subtitleLangs: []string{"en"},
+			want: []string{
+				`xmlns:podcast="https://podcastindex.org/namespace/1.0"`,
+				`<podcast:transcript url="http://new.example.com/meta/aaaaaaaaaaa.en.vtt"`,
+			},
+			notWant: []string{"<podcast:guid>", "<podcast:locked", "<podcast:funding"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			for _, dir := range []string{dataSubdirMetadata, dataSubdirEpisodes} {
+				if err := os.Mkdir(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			vi := ytVidInfo{id: "aaaaaaaaaaa", title: "Episode", published: time.Now()}
+			for _, path := range []string{
+				vi.episodePath("m4a"),
+				vi.chaptersPath(),
+				vi.transcriptPath("en", "vtt"),
+				vi.transcriptPath("en", "txt"),
+			} {
+				if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := newTestWatcher(&podcast{
+				ShortName:        "example",
+				Name:             "Example",
+				YTChannels:       []channelSource{{YTChannelHandle: "UCabcdefghijklmnopqrstuv", YTChannelHandleFormat: ChannelID, YTChannelReadableName: "Example Channel"}},
+				ItunesOwnerEmail: "owner@example.com",
+				PodcastNamespace: tc.namespace,
+				PodcastLocked:    true,
+				Persons:          []podcastPerson{{Name: "Ann", Role: "host"}},
+				SubtitleLangs:    tc.subtitleLangs,
+			})
+			w.vids = []ytVidInfo{vi}
+
+			if err := w.writeFeed(); err != nil {
+				t.Fatal(err)
+			}
+			buf, err := os.ReadFile(filepath.Join(dataSubdirMetadata, "example.xml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			feed := string(buf)
+			for _, want := range tc.want {
+				if !strings.Contains(feed, want) {
+					t.Errorf("feed lacks %s", want)
+				}
+			}
+			for _, notWant := range tc.notWant {
+				if strings.Contains(feed, notWant) {
+					t.Errorf("feed has %s", notWant)
+				}
+			}
+		})
+	}
+	podcastAccessControl.removePodcast("example")
+}
@@ -5,10 +5,11 @@ go 1.25.0
 require (
 	github.com/frou/stdext v0.0.0-20190909174947-20d00569c4d9
 	github.com/go-playground/validator/v10 v10.16.0
-	github.com/jbub/podcasts v0.2.0
+	github.com/google/uuid v1.6.0
 	github.com/snapas/resize v1.0.0
 	github.com/tzdybal/go-disk-usage v1.0.0
 	github.com/zyedidia/generic v1.2.1
+	golang.org/x/crypto v0.50.0
 	google.golang.org/api v0.278.0
 )
 
@@ -25,7 +26,6 @@ require (
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/google/s2a-go v0.1.9 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/googleapis/enterprise-certificate-proxy v0.3.15 // indirect
 	github.com/googleapis/gax-go/v2 v2.22.0 // indirect
 	github.com/leodido/go-urn v1.2.4 // indirect
@@ -34,7 +34,6 @@ require (
 	go.opentelemetry.io/otel v1.43.0 // indirect
 	go.opentelemetry.io/otel/metric v1.43.0 // indirect
 	go.opentelemetry.io/otel/trace v1.43.0 // indirect
-	golang.org/x/crypto v0.50.0 // indirect
 	golang.org/x/exp v0.0.0-20220218215828-6cf2b201936e // indirect
 	golang.org/x/net v0.53.0 // indirect
 	golang.org/x/oauth2 v0.36.0 // indirect
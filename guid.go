@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+// Each episode in a feed has a GUID, which podcast clients use to tell whether
+// they've seen it before. It's derived from the ID of the episode's vid, so
+// that it doesn't change when the server's host, port or link proxy does
+// (which would make clients treat every episode as new).
+//
+// Older versions used the episode's URL as its GUID. Unless configured not to,
+// a podcast keeps those GUIDs for the episodes already published with them.
+// They're taken from its existing feed when its watcher starts, before
+// anything overwrites it (the vids they belong to may not be known again until
+// after the first check), and kept in its state from then on.
+
+const episodeGUIDPrefix = "yt:video:"
+
+func (vi *ytVidInfo) guid() *rssGUID {
+	return &rssGUID{Value: episodeGUIDPrefix + vi.id, IsPermaLink: "false"}
+}
+
+// Whether episodes published with legacy GUIDs keep them.
+func (pod *podcast) keepsLegacyGUIDs() bool {
+	return pod.LegacyGUIDs == nil || *pod.LegacyGUIDs
+}
+
+// The caller must hold w.mu.
+func (w *watcher) episodeGUID(vi *ytVidInfo) *rssGUID {
+	if w.pod.keepsLegacyGUIDs() {
+		if guid, ok := w.legacyGUIDs[vi.id]; ok {
+			return &rssGUID{Value: guid}
+		}
+	}
+	return vi.guid()
+}
+
+// Take the legacy GUIDs of episodes from the podcast's existing feed, if they
+// aren't already known. Returns whether any were.
+//
+// The caller must hold w.mu.
+func (w *watcher) adoptLegacyGUIDs() (bool, error) {
+	buf, err := os.ReadFile(w.pod.feedPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var feed struct {
+		Items []struct {
+			GUID rssGUID `xml:"guid"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(buf, &feed); err != nil {
+		return false, err
+	}
+
+	var adopted bool
+	for _, item := range feed.Items {
+		guid := item.GUID.Value
+		if guid == "" || item.GUID.IsPermaLink == "false" {
+			continue
+		}
+		// The URL's file name is the vid's ID plus the episode file's
+		// extension.
+		id, _, _ := strings.Cut(path.Base(guid), ".")
+		if _, known := w.legacyGUIDs[id]; known || id == "" {
+			continue
+		}
+		w.legacyGUIDs[id] = guid
+		adopted = true
+	}
+	return adopted, nil
+}
+
+// Only called when w is starting, so the caller must be the only goroutine
+// using w.
+func (w *watcher) adoptLegacyGUIDsAndSave() {
+	adopted, err := w.adoptLegacyGUIDs()
+	if err != nil {
+		log.Printf("%s: Reading legacy GUIDs from feed failed: %v", w.pod, err)
+		return
+	}
+	if adopted {
+		// Even if they aren't going to be used, so that they still can be if
+		// the config is changed.
+		if err := w.saveState(); err != nil {
+			log.Printf("%s: Saving state failed: %v", w.pod, err)
+		}
+	}
+	switch {
+	case len(w.legacyGUIDs) == 0:
+	case w.pod.keepsLegacyGUIDs():
+		log.Printf("%s: Keeping the legacy GUIDs of %d episodes", w.pod, len(w.legacyGUIDs))
+	default:
+		log.Printf("Warning: %s: legacy_guids is false, so %d episodes published with legacy GUIDs get new ones, and subscribers' podcast clients will treat them as new episodes",
+			w.pod, len(w.legacyGUIDs))
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/zyedidia/generic/mapset"
+)
+
+// A feed as written by versions that used episodes' URLs as their GUIDs.
+const legacyFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+  <channel>
+    <title>Example</title>
+    <item>
+      <title>Second</title>
+      <guid>http://old.example.com:8080/ep/bbbbbbbbbbb.m4a</guid>
+      <enclosure url="http://old.example.com:8080/ep/bbbbbbbbbbb.m4a" length="2" type="audio/m4a"></enclosure>
+    </item>
+    <item>
+      <title>First</title>
+      <guid>http://old.example.com:8080/ep/aaaaaaaaaaa.m4a</guid>
+      <enclosure url="http://old.example.com:8080/ep/aaaaaaaaaaa.m4a" length="1" type="audio/m4a"></enclosure>
+    </item>
+    <item>
+      <title>Already migrated</title>
+      <guid isPermaLink="false">yt:video:ccccccccccc</guid>
+    </item>
+  </channel>
+</rss>
+`
+
+func newTestWatcher(pod *podcast) *watcher {
+	return &watcher{
+		cfg:         &config{ServeHost: "new.example.com", ServePort: 80, YTDLWriteExt: "m4a"},
+		pod:         pod,
+		pendingVids: mapset.New[string](),
+		problemVids: make(map[string]*problemVid),
+		legacyGUIDs: make(map[string]string),
+	}
+}
+
+func TestLegacyGUIDsSurviveUpgrade(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir(dataSubdirMetadata, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// legacy_guids isn't set, so defaults to true.
+	pod := &podcast{ShortName: "example"}
+	if err := os.WriteFile(pod.feedPath(), []byte(legacyFeed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Straight after upgrading, there's no state, so no vids are known yet.
+	w := newTestWatcher(pod)
+	if err := w.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	w.adoptLegacyGUIDsAndSave()
+	if len(w.legacyGUIDs) != 2 {
+		t.Fatalf("adopted %v, want 2 GUIDs", w.legacyGUIDs)
+	}
+
+	// The feed is overwritten (e.g. with no items, before the first check),
+	// then the program restarts.
+	if err := os.WriteFile(pod.feedPath(), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w = newTestWatcher(pod)
+	if err := w.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	w.adoptLegacyGUIDsAndSave()
+
+	for _, tc := range []struct {
+		id, guid, isPermaLink string
+	}{
+		{"aaaaaaaaaaa", "http://old.example.com:8080/ep/aaaaaaaaaaa.m4a", ""},
+		{"bbbbbbbbbbb", "http://old.example.com:8080/ep/bbbbbbbbbbb.m4a", ""},
+		{"ccccccccccc", "yt:video:ccccccccccc", "false"},
+		{"ddddddddddd", "yt:video:ddddddddddd", "false"},
+	} {
+		got := w.episodeGUID(&ytVidInfo{id: tc.id})
+		if got.Value != tc.guid || got.IsPermaLink != tc.isPermaLink {
+			t.Errorf("GUID of %s = %+v, want %q (isPermaLink %q)", tc.id, *got, tc.guid, tc.isPermaLink)
+		}
+	}
+
+	keep := false
+	pod.LegacyGUIDs = &keep
+	if got := w.episodeGUID(&ytVidInfo{id: "aaaaaaaaaaa"}); got.Value != "yt:video:aaaaaaaaaaa" {
+		t.Errorf("GUID without legacy_guids = %q", got.Value)
+	}
+}
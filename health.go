@@ -1,10 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -29,77 +31,240 @@ import (
 //    disk_low      OK
 //    ytdl_old      CONCERN
 //    feeds_stale   OK
+//    vids_given_up OK
+//
+// Adding ?format=json to the request (or sending Accept: application/json)
+// gets details of each check as JSON instead, with the response's status code
+// being 503 if there's any cause for concern.
 
 const (
 	httpHealthPrefix = "/health/"
+
+	healthStatusOK      = "OK"
+	healthStatusConcern = "CONCERN"
 )
 
 //nolint:gochecknoglobals
 var (
 	healthConcerns = map[string]healthFunc{
-		"disk_low":    diskLow,
-		"ytdl_old":    downloaderOld,
-		"feeds_stale": feedsStale,
+		"disk_low":      diskLow,
+		"ytdl_old":      downloaderOld,
+		"feeds_stale":   feedsStale,
+		"vids_given_up": vidsGivenUp,
 	}
+	// Defined in the config file.
+	customHealthConcerns = make(map[string]healthFunc)
 
 	lastDownloaderVersionCheck struct {
 		mu     sync.Mutex
 		when   time.Time
 		result string
 	}
+
+	// Podcast short name -> count
+	givenUpVidCounts = struct {
+		mu sync.Mutex
+		m  map[string]int
+	}{m: make(map[string]int)}
 )
 
 const (
-	// @todo #0 Make diskLowThreshold & ytdlOldThreshold customizable in the config file.
-	diskLowThreshold       = 1024 * 1024 * 1024  // 1GB
-	downloaderOldThreshold = time.Hour * 24 * 60 // 60 days
-	// @todo #0 Make feedsStaleThreshold customizable per-podcast in the config file.
-	feedsStaleThreshold = time.Hour * 24 * 10 // 10 days
+	defaultDiskLowMB           = 1024 // 1GB
+	defaultDownloaderOldDays   = 60
+	defaultFeedsStaleDays      = 10
+	defaultMaxGivenUpVids      = 10
+	defaultCustomHealthTimeout = 10 * time.Second
 
 	downloaderVersionCheckCacheDuration = time.Minute * 5
 )
 
+// Set from the config file by configureHealth.
+//
+//nolint:gochecknoglobals
+var (
+	diskLowThreshold       uint64 = defaultDiskLowMB * 1024 * 1024
+	downloaderOldThreshold        = defaultDownloaderOldDays * 24 * time.Hour
+	feedsStaleThreshold           = defaultFeedsStaleDays * 24 * time.Hour
+	givenUpVidsThreshold          = defaultMaxGivenUpVids
+)
+
+// Apply the health-related parts of cfg. This must be done before the health
+// handler is first used.
+func configureHealth(cfg *config) {
+	diskLowThreshold = uint64(cfg.HealthDiskLowMB) * 1024 * 1024
+	downloaderOldThreshold = time.Duration(cfg.HealthDownloaderOldDays) * 24 * time.Hour
+	feedsStaleThreshold = time.Duration(cfg.HealthFeedsStaleDays) * 24 * time.Hour
+	givenUpVidsThreshold = cfg.HealthMaxGivenUpVids
+	for i := range cfg.HealthChecks {
+		hc := &cfg.HealthChecks[i]
+		customHealthConcerns[hc.Name] = hc.run
+	}
+}
+
+// Returns the daemon-wide health checks and those of the podcasts for which
+// mayReport returns true, keyed by name.
+func allHealthChecks(mayReport func(shortName string) bool) map[string]healthFunc {
+	checks := podcastHealths.checks(mayReport)
+	for name, f := range customHealthConcerns {
+		checks[name] = f
+	}
+	for name, f := range healthConcerns {
+		checks[name] = f
+	}
+	return checks
+}
+
+// Whether path is that of the health handler, which is served both with and
+// without the trailing slash.
+func isHealthPath(path string) bool {
+	return strings.HasPrefix(path, httpHealthPrefix) || path == strings.TrimSuffix(httpHealthPrefix, "/")
+}
+
+type healthCheckReport struct {
+	Status    string  `json:"status"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Unit      string  `json:"unit"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func runHealthCheck(name string, f healthFunc) healthCheckReport {
+	res, err := f()
+	report := healthCheckReport{
+		Status:    healthStatusOK,
+		Value:     res.value,
+		Threshold: res.threshold,
+		Unit:      res.unit,
+		Error:     res.reason,
+	}
+	if err != nil {
+		log.Printf("health: %v: %v", name, err)
+		report.Error = err.Error()
+	}
+	if err != nil || res.concern {
+		report.Status = healthStatusConcern
+	}
+	return report
+}
+
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	name := strings.TrimPrefix(r.URL.Path, httpHealthPrefix)
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(httpHealthPrefix, "/")), "/")
 
-	check := func(name string, f healthFunc) string {
-		flag, err := f()
-		if err != nil {
-			log.Printf("health: %v: %v", name, err)
+	checks := make(map[string]healthFunc)
+	// Private podcasts' checks are left out, like their other details.
+	all := allHealthChecks(podcastAccessControl.reportFilter(r))
+	if f, found := all[name]; found {
+		checks[name] = f
+	} else if name == "" {
+		checks = all
+	} else {
+		// e.g. all of a podcast's checks.
+		for checkName, f := range all {
+			if strings.HasPrefix(checkName, name+"/") {
+				checks[checkName] = f
+			}
 		}
-		if err != nil || flag {
-			return "CONCERN"
+		if len(checks) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	reports := make(map[string]healthCheckReport, len(checks))
+	overall := healthStatusOK
+	for name, f := range checks {
+		reports[name] = runHealthCheck(name, f)
+		if reports[name].Status != healthStatusOK {
+			overall = healthStatusConcern
 		}
-		return "OK"
 	}
 
-	f, found := healthConcerns[name]
-	if found {
-		fmt.Fprintln(w, check(name, f))
-	} else {
-		if name == "" {
-			for name, f := range healthConcerns {
-				fmt.Fprintln(w, name, "\t", check(name, f))
+	if !wantsJSON(r) {
+		if _, single := reports[name]; single {
+			fmt.Fprintln(w, reports[name].Status)
+			return
+		}
+		names := make([]string, 0, len(reports))
+		for name := range reports {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			fmt.Fprintln(w, name, "\t", reports[name].Status)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if overall != healthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	err := enc.Encode(struct {
+		Status string                       `json:"status"`
+		Checks map[string]healthCheckReport `json:"checks"`
+	}{overall, reports})
+	if err != nil {
+		log.Printf("health: %v", err)
+	}
+}
+
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.TrimSpace(mediaType) == "application/json" {
+				return true
 			}
-		} else {
-			http.NotFound(w, r)
 		}
 	}
+	return false
 }
 
 // ------------------------------------------------------------
 
-// The bool flag being true or there being an error means cause for concern.
-type healthFunc func() (bool, error)
+// The result of a health check: what was measured, and the threshold it was
+// compared to in order to decide whether there's cause for concern.
+type healthResult struct {
+	concern          bool
+	value, threshold float64
+	unit             string
+	// Optionally, why there's cause for concern.
+	reason string
+}
+
+// The result's concern flag being true or there being an error means cause
+// for concern.
+type healthFunc func() (healthResult, error)
 
-func diskLow() (bool, error) {
-	ok := du.NewDiskUsage(".").Available() < diskLowThreshold
-	return ok, nil
+func diskLow() (healthResult, error) {
+	available := du.NewDiskUsage(".").Available()
+	return healthResult{
+		concern:   available < diskLowThreshold,
+		value:     float64(available),
+		threshold: float64(diskLowThreshold),
+		unit:      "bytes",
+	}, nil
 }
 
 var yearMonthDayRevnumVersionRE = regexp.MustCompile(`^(\d+\.\d+\.\d+)(\.\d+)?$`)
 
-func downloaderOld() (bool, error) {
+func downloaderOld() (healthResult, error) {
+	res := healthResult{threshold: downloaderOldThreshold.Seconds(), unit: "seconds"}
+	age, err := downloaderVersionAge()
+	if err != nil {
+		return res, err
+	}
+	res.value = age.Seconds()
+	res.concern = age > downloaderOldThreshold
+	return res, nil
+}
+
+// Returns how long ago the downloader command's version was released.
+func downloaderVersionAge() (time.Duration, error) {
 	var version string
 	lastDownloaderVersionCheck.mu.Lock()
 	defer lastDownloaderVersionCheck.mu.Unlock()
@@ -109,7 +274,7 @@ func downloaderOld() (bool, error) {
 		var err error
 		version, err = getDownloaderCommandVersion()
 		if err != nil {
-			return false, err
+			return 0, err
 		}
 		lastDownloaderVersionCheck.when = time.Now()
 		lastDownloaderVersionCheck.result = version
@@ -117,19 +282,48 @@ func downloaderOld() (bool, error) {
 
 	submatches := yearMonthDayRevnumVersionRE.FindStringSubmatch(version)
 	if submatches == nil {
-		return false, fmt.Errorf("Can't parse downloader command's version output %q because it has an unexpected format", version)
+		return 0, fmt.Errorf("Can't parse downloader command's version output %q because it has an unexpected format", version)
 	}
 
 	versionTime, err := time.Parse("2006.1.2", submatches[1])
 	if err != nil {
-		return false, err
+		return 0, err
+	}
+	return time.Since(versionTime), nil
+}
+
+func feedsStale() (healthResult, error) {
+	since := time.Since(lastTimeAnyFeedWritten.Get())
+	return healthResult{
+		concern:   since > feedsStaleThreshold,
+		value:     since.Seconds(),
+		threshold: feedsStaleThreshold.Seconds(),
+		unit:      "seconds",
+	}, nil
+}
+
+// Whether many vids' downloads have been given up on (e.g. because they are
+// private or members-only). The odd one is to be expected, so isn't a concern.
+// The reasons are logged.
+func vidsGivenUp() (healthResult, error) {
+	givenUpVidCounts.mu.Lock()
+	defer givenUpVidCounts.mu.Unlock()
+	var total int
+	for _, n := range givenUpVidCounts.m {
+		total += n
 	}
-	age := time.Since(versionTime)
-	return age > downloaderOldThreshold, nil
+	return healthResult{
+		concern:   total >= givenUpVidsThreshold,
+		value:     float64(total),
+		threshold: float64(givenUpVidsThreshold),
+		unit:      "vids",
+	}, nil
 }
 
-func feedsStale() (bool, error) {
-	return time.Since(lastTimeAnyFeedWritten.Get()) > feedsStaleThreshold, nil
+func setGivenUpVidCount(podcastShortName string, n int) {
+	givenUpVidCounts.mu.Lock()
+	defer givenUpVidCounts.mu.Unlock()
+	givenUpVidCounts.m[podcastShortName] = n
 }
 
 // ------------------------------------------------------------
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWantsJSON(t *testing.T) {
+	for _, tc := range []struct {
+		url, accept string
+		want        bool
+	}{
+		{"/health", "", false},
+		{"/health?format=json", "", true},
+		{"/health?format=text", "application/json", false},
+		{"/health", "application/json", true},
+		{"/health", "text/html, application/json;q=0.9", true},
+		{"/health", "text/plain", false},
+	} {
+		r := httptest.NewRequest("GET", tc.url, nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		if got := wantsJSON(r); got != tc.want {
+			t.Errorf("%s with Accept %q: wants JSON = %v, want %v", tc.url, tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	builtin := healthConcerns
+	healthConcerns = map[string]healthFunc{
+		"fine": func() (healthResult, error) {
+			return healthResult{value: 1, threshold: 2, unit: "things"}, nil
+		},
+		"worried": func() (healthResult, error) {
+			return healthResult{concern: true, value: 3, threshold: 2, unit: "things", reason: "too many"}, nil
+		},
+		"broken": func() (healthResult, error) {
+			return healthResult{}, errors.New("can't tell")
+		},
+	}
+	defer func() { healthConcerns = builtin }()
+
+	for _, tc := range []struct {
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/health/fine", http.StatusOK, "OK\n"},
+		{"/health/worried", http.StatusOK, "CONCERN\n"},
+		{"/health/missing", http.StatusNotFound, ""},
+		{"/health", http.StatusOK, "broken \t CONCERN\nfine \t OK\nworried \t CONCERN\n"},
+		{"/health/", http.StatusOK, "broken \t CONCERN\nfine \t OK\nworried \t CONCERN\n"},
+		{"/health/fine?format=json", http.StatusOK, ""},
+		{"/health?format=json", http.StatusServiceUnavailable, ""},
+	} {
+		rec := httptest.NewRecorder()
+		healthHandler(rec, httptest.NewRequest("GET", tc.url, nil))
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%s: status %d, want %d", tc.url, rec.Code, tc.wantStatus)
+		}
+		if tc.wantBody != "" && rec.Body.String() != tc.wantBody {
+			t.Errorf("%s: body %q, want %q", tc.url, rec.Body.String(), tc.wantBody)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	healthHandler(rec, httptest.NewRequest("GET", "/health?format=json", nil))
+	var resp struct {
+		Status string                       `json:"status"`
+		Checks map[string]healthCheckReport `json:"checks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]healthCheckReport{
+		"fine":    {Status: healthStatusOK, Value: 1, Threshold: 2, Unit: "things"},
+		"worried": {Status: healthStatusConcern, Value: 3, Threshold: 2, Unit: "things", Error: "too many"},
+		"broken":  {Status: healthStatusConcern, Error: "can't tell"},
+	}
+	if resp.Status != healthStatusConcern || len(resp.Checks) != len(want) {
+		t.Fatalf("got %+v", resp)
+	}
+	for name, report := range want {
+		if resp.Checks[name] != report {
+			t.Errorf("%s: got %+v, want %+v", name, resp.Checks[name], report)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type %q", ct)
+	}
+}
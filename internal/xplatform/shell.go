@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package xplatform
+
+import (
+	"context"
+	"os/exec"
+)
+
+func ShellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
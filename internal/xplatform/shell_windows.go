@@ -0,0 +1,10 @@
+package xplatform
+
+import (
+	"context"
+	"os/exec"
+)
+
+func ShellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
@@ -12,3 +12,7 @@ import (
 func RegisterStalenessResetter(f func()) {
 	stdext.HandleSignal(syscall.SIGUSR1, true, f)
 }
+
+func RegisterConfigReloader(f func()) {
+	stdext.HandleSignal(syscall.SIGHUP, true, f)
+}
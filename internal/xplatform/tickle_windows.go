@@ -1,3 +1,5 @@
 package xplatform
 
 func RegisterStalenessResetter(f func()) {}
+
+func RegisterConfigReloader(f func()) {}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// As well as the basics, feeds carry the iTunes-specific metadata that Apple
+// Podcasts (and most other podcast clients) make use of: each episode's
+// duration, image, explicitness, type, and season & episode numbers, and the
+// podcast's category, owner and explicitness.
+//
+// REF: https://podcasters.apple.com/support/823-podcast-requirements
+
+// Details of a vid that searches and playlist listings don't include, so are
+// fetched separately.
+type vidDetails struct {
+	duration      time.Duration
+	thumbnail     string
+	ageRestricted bool
+}
+
+// Every vid has a thumbnail, so one without any has had no details fetched.
+func (d *vidDetails) fetched() bool {
+	return d.thumbnail != ""
+}
+
+// The most vids that a single Videos.List request can ask about.
+const ytAPIVideosListMaxIDs = 50
+
+// Fetch the details of the vids with ids, keyed by ID. Vids that no longer
+// exist are missing from the result.
+func (w *watcher) getVidDetails(ids []string) (map[string]vidDetails, error) {
+	details := make(map[string]vidDetails, len(ids))
+	for start := 0; start < len(ids); start += ytAPIVideosListMaxIDs {
+		batch := ids[start:min(start+ytAPIVideosListMaxIDs, len(ids))]
+		w.countAPICall(ytAPIVideosList)
+		apiResp, err := w.ytAPI.Videos.List([]string{"snippet", "contentDetails"}).
+			Id(batch...).
+			MaxResults(ytAPIVideosListMaxIDs).
+			Do()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range apiResp.Items {
+			var d vidDetails
+			if item.Snippet != nil {
+				d.thumbnail = bestThumbnailURL(item.Snippet.Thumbnails)
+			}
+			if cd := item.ContentDetails; cd != nil {
+				// Vids that are yet to be streamed have a duration of zero.
+				d.duration, _ = parseISO8601Duration(cd.Duration)
+				d.ageRestricted = cd.ContentRating != nil && cd.ContentRating.YtRating == "ytAgeRestricted"
+			}
+			details[item.Id] = d
+		}
+	}
+	return details, nil
+}
+
+// Fill in the details of latestVids and, on the initial check, of any known
+// vids (e.g. restored from state saved by an older version) lacking them. A
+// failure isn't fatal to the check, because the details are nice to have,
+// and an episode's duration can instead be found out once it's downloaded.
+//
+// Only the watch goroutine calls this.
+func (w *watcher) fillVidDetails(latestVids []ytVidInfo) {
+	var ids []string
+	for _, vi := range latestVids {
+		ids = append(ids, vi.id)
+	}
+	if w.initialCheck {
+		for _, vi := range w.vids {
+			if !vi.fetched() {
+				ids = append(ids, vi.id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	details, err := w.getVidDetails(ids)
+	if err != nil {
+		log.Printf("%s: Getting details of %d vids failed: %v", w.pod, len(ids), err)
+		return
+	}
+	for i := range latestVids {
+		if d, ok := details[latestVids[i].id]; ok {
+			latestVids[i].vidDetails = d
+		}
+	}
+	if !w.initialCheck {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.vids {
+		vi := &w.vids[i]
+		if d, ok := details[vi.id]; ok && !vi.fetched() {
+			vi.vidDetails = d
+			if pv, isProblem := w.problemVids[vi.id]; isProblem {
+				pv.vi.vidDetails = d
+			}
+			w.feedOutdated = true
+		}
+	}
+}
+
+// Record the duration of the vid with id, if it isn't already known. The
+// caller must hold w.mu.
+func (w *watcher) setVidDuration(id string, d time.Duration) {
+	for i := range w.vids {
+		if w.vids[i].id == id && w.vids[i].duration == 0 {
+			w.vids[i].duration = d
+		}
+	}
+}
+
+// e.g. "PT1H2M3S" or "P1DT30M"
+var iso8601DurationFormat = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+func parseISO8601Duration(s string) (time.Duration, error) {
+	m := iso8601DurationFormat.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("malformed duration %q", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+const (
+	durationProbeCommand = "ffprobe"
+	// Probing only reads the file's header, so should be quick.
+	durationProbeTimeout = time.Minute
+)
+
+// Find out the duration of the media file at path.
+func probeDuration(ctx context.Context, path string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, durationProbeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, durationProbeCommand,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path)
+	cmd.WaitDelay = downloaderWaitDelay
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", durationProbeCommand, err)
+	}
+	secs, err := strconv.ParseFloat(string(bytes.TrimSpace(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", durationProbeCommand, err)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// ------------------------------------------------------------
+
+// Season & episode numbers are derived from titles like "S2E5", "Season 2,
+// Episode 5", "Episode 12" or "Ep. 12".
+//
+//nolint:gochecknoglobals
+var (
+	seasonEpisodeTitleFormats = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bS(\d{1,3}) ?E(\d{1,4})\b`),
+		regexp.MustCompile(`(?i)\bseason (\d{1,3})\W+(?:episode|ep\.?) ?(\d{1,4})\b`),
+	}
+	episodeTitleFormat = regexp.MustCompile(`(?i)\b(?:episode|ep\.?) ?#?(\d{1,4})\b`)
+
+	trailerTitleFormat = regexp.MustCompile(`(?i)\b(?:trailer|teaser)\b`)
+	bonusTitleFormat   = regexp.MustCompile(`(?i)\bbonus\b`)
+)
+
+// Returns zero for a number that can't be derived from title.
+func parseEpisodeNumbering(title string) (season, episode int) {
+	for _, re := range seasonEpisodeTitleFormats {
+		if m := re.FindStringSubmatch(title); m != nil {
+			season, _ = strconv.Atoi(m[1])
+			episode, _ = strconv.Atoi(m[2])
+			return season, episode
+		}
+	}
+	if m := episodeTitleFormat.FindStringSubmatch(title); m != nil {
+		episode, _ = strconv.Atoi(m[1])
+	}
+	return 0, episode
+}
+
+func episodeType(title string) string {
+	switch {
+	case trailerTitleFormat.MatchString(title):
+		return "trailer"
+	case bonusTitleFormat.MatchString(title):
+		return "bonus"
+	default:
+		return "full"
+	}
+}
+
+func itunesBool(b bool) string {
+	return strconv.FormatBool(b)
+}
+
+// Parse a category in the form "Category" or "Category > Subcategory".
+func parseItunesCategory(s string) *itunesCategory {
+	if s == "" {
+		return nil
+	}
+	parts := strings.SplitN(s, ">", 2)
+	cat := &itunesCategory{Text: strings.TrimSpace(parts[0])}
+	if len(parts) == 2 {
+		cat.Subcategories = []*itunesCategory{{Text: strings.TrimSpace(parts[1])}}
+	}
+	return cat
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseISO8601Duration(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"PT1H2M3S", time.Hour + 2*time.Minute + 3*time.Second, false},
+		{"PT45S", 45 * time.Second, false},
+		{"PT10M", 10 * time.Minute, false},
+		{"PT2H", 2 * time.Hour, false},
+		{"P1DT30M", 24*time.Hour + 30*time.Minute, false},
+		// Live streams that haven't started.
+		{"P0D", 0, false},
+		{"", 0, true},
+		{"1:02:03", 0, true},
+		{"PT1.5S", 0, true},
+		{"P1W", 0, true},
+	} {
+		got, err := parseISO8601Duration(tc.in)
+		if got != tc.want || (err != nil) != tc.wantErr {
+			t.Errorf("parseISO8601Duration(%q) = %v, %v; want %v (error: %v)", tc.in, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestParseEpisodeNumbering(t *testing.T) {
+	for _, tc := range []struct {
+		title           string
+		season, episode int
+	}{
+		{"The Show S2E5: Guests", 2, 5},
+		{"s03 e12 - Finale", 3, 12},
+		{"Season 2, Episode 5 | Guests", 2, 5},
+		{"Season 4 - Ep. 7", 4, 7},
+		{"Episode 12: Something", 0, 12},
+		{"EP12 Something", 0, 12},
+		{"Ep. #99", 0, 99},
+		{"Something else entirely", 0, 0},
+		{"Prepared remarks", 0, 0},
+	} {
+		season, episode := parseEpisodeNumbering(tc.title)
+		if season != tc.season || episode != tc.episode {
+			t.Errorf("parseEpisodeNumbering(%q) = %d, %d; want %d, %d", tc.title, season, episode, tc.season, tc.episode)
+		}
+	}
+}
+
+func TestEpisodeType(t *testing.T) {
+	for _, tc := range []struct {
+		title, want string
+	}{
+		{"Official Trailer", "trailer"},
+		{"Season 2 teaser", "trailer"},
+		{"Bonus: Q&A", "bonus"},
+		{"Episode 3", "full"},
+		{"Trailers reviewed", "full"},
+	} {
+		if got := episodeType(tc.title); got != tc.want {
+			t.Errorf("episodeType(%q) = %q, want %q", tc.title, got, tc.want)
+		}
+	}
+}
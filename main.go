@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"google.golang.org/api/option"
-	"google.golang.org/api/youtube/v3"
+	"github.com/frou/yt2pod/internal/xplatform"
 )
 
 const (
@@ -19,6 +24,9 @@ const (
 	hitLoggingPeriod       = 24 * time.Hour
 	websrvClientReadTimout = 15 * time.Second
 	ytAPIRespiteUnit       = 5 * time.Minute
+	defaultDownloadWorkers = 2
+	downloaderWaitDelay    = 10 * time.Second
+	shutdownTimeout        = 30 * time.Second
 )
 
 var (
@@ -36,6 +44,9 @@ var (
 
 	flagPrintVersion = flag.Bool("version", false,
 		"print version information then exit")
+
+	flagPrintStats = flag.Bool("stats", false,
+		"print a report of the download statistics saved in the data directory then exit")
 )
 
 func main() {
@@ -59,18 +70,24 @@ func run(cfg *config) error {
 		cleanc = make(chan *cleaningWhitelist)
 	}
 
+	// Stop downloading when asked to terminate.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sched := newDownloadScheduler(ctx,
+		cfg.DownloadWorkers, time.Duration(cfg.DownloadTimeoutMins)*time.Minute)
+
+	watchers := newWatcherSet(ctx, cfg, sched)
+	watchers.mu.Lock()
 	for i := range cfg.Podcasts {
-		ytAPI, err := youtube.NewService(context.Background(), option.WithAPIKey(apiKey))
-		if err != nil {
-			return err
-		}
-		wat, err := newWatcher(
-			ytAPI, cfg, &cfg.Podcasts[i], cleanc)
-		if err != nil {
+		if err := watchers.start(&cfg.Podcasts[i], cleanc); err != nil {
 			log.Fatal(err)
 		}
-		go wat.watch()
 	}
+	watchers.mu.Unlock()
+	xplatform.RegisterConfigReloader(func() {
+		watchers.reload(*flagConfigPath)
+	})
 
 	if *flagDataClean {
 		n, err := clean(len(cfg.Podcasts), cleanc)
@@ -80,33 +97,138 @@ func run(cfg *config) error {
 		log.Printf("Clean removed %d files", n)
 	}
 
+	if err := stats.load(); err != nil {
+		return err
+	}
+	stats.behindProxy = cfg.LinkProxy != ""
+	go stats.runLoop()
+
 	// Run a webserver to serve the episode and metadata files.
 
 	mux := http.NewServeMux()
 
 	files := newHitLoggingFsys(http.Dir("."), hitLoggingPeriod, cfg.ServeDirectoryListings)
-	mux.Handle("/", http.FileServer(files))
+	mux.Handle("/", podcastAccessControl.handler(http.FileServer(files)))
 
 	mux.HandleFunc(httpHealthPrefix, healthHandler)
+	mux.HandleFunc(strings.TrimSuffix(httpHealthPrefix, "/"), healthHandler)
+	mux.HandleFunc(httpStatusPath, sched.statusHandler)
+	mux.HandleFunc(httpMetricsPath, metricsHandler(sched))
+	mux.HandleFunc(httpStatsPath, stats.handler)
+
+	var handler http.Handler = mux
+	if cfg.Auth != nil {
+		auth, err := newAuthenticator(cfg.Auth)
+		if err != nil {
+			return err
+		}
+		handler = auth.handler(mux)
+	}
 
 	websrv := http.Server{
 		Addr:    fmt.Sprint(cfg.ServeHost, ":", cfg.ServePort),
-		Handler: mux,
+		Handler: handler,
 		// Conserve # open FDs by pruning persistent (keep-alive) HTTP conns.
 		ReadTimeout: websrvClientReadTimout,
 	}
-	err := websrv.ListenAndServe()
+	servers := []*http.Server{&websrv}
+	if cfg.tlsEnabled() {
+		redirectsrv, err := configureTLS(&websrv, cfg)
+		if err != nil {
+			return err
+		}
+		if redirectsrv != nil {
+			servers = append(servers, redirectsrv)
+		}
+	}
+	servec := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			servec <- serve(srv)
+		}()
+	}
+
+	select {
+	case err := <-servec:
+		return err
+	case <-ctx.Done():
+	}
+	// Let a second signal terminate immediately.
+	stop()
+	log.Print("Shutting down")
+	return shutdown(servers, watchers, sched)
+}
+
+// Stop the watchers, downloads and web servers in an orderly fashion. The
+// scheduler's context must already be done. Every step is taken even if an
+// earlier one fails, and all the failures are returned.
+func shutdown(servers []*http.Server, watchers *watcherSet, sched *downloadScheduler) error {
+	deadline, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Feed writes that are in progress are allowed to finish, but no more
+	// checks are made.
+	watchers.stopAll()
+
+	downloadsc := make(chan struct{})
+	go func() {
+		sched.wait()
+		close(downloadsc)
+	}()
+	var errs []error
+	// Requests that are in progress are allowed to finish (until the
+	// deadline, when their connections are closed).
+	for _, srv := range servers {
+		if err := srv.Shutdown(deadline); err != nil {
+			log.Printf("Shutting down web server failed: %v", err)
+			errs = append(errs, fmt.Errorf("shutting down web server: %w", err))
+			srv.Close()
+		}
+	}
+	if err := stats.save(); err != nil {
+		log.Printf("Saving stats failed: %v", err)
+		errs = append(errs, fmt.Errorf("saving stats: %w", err))
+	}
+	select {
+	case <-downloadsc:
+	case <-deadline.Done():
+		// The downloads may have finished while the web servers used up the
+		// time.
+		select {
+		case <-downloadsc:
+		default:
+			errs = append(errs, errors.New("timed out waiting for in-flight downloads to be cancelled"))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	log.Print("Shutdown complete")
+	return nil
+}
+
+func serve(websrv *http.Server) error {
+	listenAndServe := websrv.ListenAndServe
+	if websrv.TLSConfig != nil {
+		// The certificate comes from the TLS config.
+		listenAndServe = func() error { return websrv.ListenAndServeTLS("", "") }
+	}
+	err := listenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
 	// @todo #0 When listening on cfg.ServeHost fails and an alternative address is listened
 	//  on, cfg.ServeHost should not be used in watcher#buildURL.
 	//  How about instead of automatically falling back to trying to listen on all
 	//  interfaces, add a serve_host_fallback:"localhost" to config? Then if
 	//  neither serve_host or serve_host_fallback work, it's a fatal error.
 	if err != nil {
-		samePortAllInterfaces := fmt.Sprint(":", cfg.ServePort)
+		_, port, _ := net.SplitHostPort(websrv.Addr)
+		samePortAllInterfaces := ":" + port
 		log.Printf("Web server could not listen on %v, trying %v instead",
 			websrv.Addr, samePortAllInterfaces)
 		websrv.Addr = samePortAllInterfaces
-		err = websrv.ListenAndServe()
+		err = listenAndServe()
 	}
 	return err
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		metadataDir bool
+		wantErr     string
+	}{
+		{"clean", true, ""},
+		// The other steps are still taken.
+		{"saving stats fails", false, "saving stats"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			if tc.metadataDir {
+				if err := os.Mkdir(dataSubdirMetadata, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			stats.mu.Lock()
+			stats.dirty = true
+			stats.mu.Unlock()
+
+			// A request is in progress when shutdown begins.
+			entered, release := make(chan struct{}), make(chan struct{})
+			srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(entered)
+				<-release
+			})}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			servec := make(chan error, 1)
+			go func() { servec <- srv.Serve(ln) }()
+			respc := make(chan error, 1)
+			go func() {
+				resp, err := http.Get("http://" + ln.Addr().String())
+				if err == nil {
+					resp.Body.Close()
+				}
+				respc <- err
+			}()
+			<-entered
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			sched := newDownloadScheduler(ctx, 1, 0)
+			watchers := newWatcherSet(ctx, &config{}, sched)
+			shutdownc := make(chan error, 1)
+			go func() { shutdownc <- shutdown([]*http.Server{srv}, watchers, sched) }()
+
+			// Once the watchers are stopped, the web server is next.
+			for {
+				watchers.mu.Lock()
+				stopped := watchers.stopped
+				watchers.mu.Unlock()
+				if stopped {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			close(release)
+			err = <-shutdownc
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("shutdown failed: %v", err)
+			} else if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("shutdown error = %v, want one about %s", err, tc.wantErr)
+			}
+			if err := <-respc; err != nil {
+				t.Errorf("request in progress failed: %v", err)
+			}
+			if err := <-servec; !errors.Is(err, http.ErrServerClosed) {
+				t.Errorf("server stopped with %v", err)
+			}
+			_, err = os.Stat(statsPath)
+			if saved := err == nil; saved != tc.metadataDir {
+				t.Errorf("stats saved = %v, want %v", saved, tc.metadataDir)
+			}
+		})
+	}
+	stats.mu.Lock()
+	stats.dirty = false
+	stats.mu.Unlock()
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tzdybal/go-disk-usage/du"
+)
+
+// Metrics are served at /metrics in the Prometheus text exposition format, so
+// that they can be scraped and graphed/alerted on.
+//
+// REF: https://prometheus.io/docs/instrumenting/exposition_formats/
+
+const (
+	httpMetricsPath = "/metrics"
+	metricsPrefix   = "yt2pod_"
+)
+
+type ytAPIMethod int
+
+const (
+	ytAPISearchList ytAPIMethod = iota
+	ytAPIChannelsList
+	ytAPIPlaylistsList
+	ytAPIPlaylistItemsList
+	ytAPIVideosList
+	ytAPIMethodCount
+)
+
+// REF: https://developers.google.com/youtube/v3/determine_quota_cost
+//
+//nolint:gochecknoglobals
+var ytAPIMethods = [ytAPIMethodCount]struct {
+	name      string
+	quotaCost uint64
+}{
+	ytAPISearchList:        {"search.list", 100},
+	ytAPIChannelsList:      {"channels.list", 1},
+	ytAPIPlaylistsList:     {"playlists.list", 1},
+	ytAPIPlaylistItemsList: {"playlistItems.list", 1},
+	ytAPIVideosList:        {"videos.list", 1},
+}
+
+type podcastMetrics struct {
+	apiCalls           [ytAPIMethodCount]atomic.Uint64
+	checks             atomic.Uint64
+	checkFailures      atomic.Uint64
+	checkNanos         atomic.Int64
+	downloadsSucceeded atomic.Uint64
+	downloadsFailed    atomic.Uint64
+	problemVids        atomic.Int64
+	givenUpVids        atomic.Int64
+	bytesServed        atomic.Uint64
+	// Unix time, or zero if never.
+	feedWritten atomic.Int64
+}
+
+type metricsRegistry struct {
+	mu       sync.Mutex
+	podcasts map[string]*podcastMetrics // Keyed by podcast short name
+}
+
+//nolint:gochecknoglobals
+var metrics = &metricsRegistry{podcasts: make(map[string]*podcastMetrics)}
+
+// Returns the metrics for the podcast named shortName, creating them if need
+// be.
+func (m *metricsRegistry) podcast(shortName string) *podcastMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pm, ok := m.podcasts[shortName]
+	if !ok {
+		pm = new(podcastMetrics)
+		m.podcasts[shortName] = pm
+	}
+	return pm
+}
+
+func (m *metricsRegistry) removePodcast(shortName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.podcasts, shortName)
+}
+
+func (w *watcher) countAPICall(method ytAPIMethod) {
+	metrics.podcast(w.pod.ShortName).apiCalls[method].Add(1)
+}
+
+func (w *watcher) recordCheck(took time.Duration, err error) {
+	pm := metrics.podcast(w.pod.ShortName)
+	pm.checks.Add(1)
+	pm.checkNanos.Add(int64(took))
+	if err != nil {
+		pm.checkFailures.Add(1)
+	}
+	podcastHealths.checkFinished(w.pod.ShortName, err)
+}
+
+// ------------------------------------------------------------
+
+// Returns a handler that serves all the metrics. Those of private podcasts are
+// only included if the request carries one of their tokens.
+func metricsHandler(sched *downloadScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		writeMetrics(bw, sched, podcastAccessControl.reportFilter(r))
+		if err := bw.Flush(); err != nil {
+			log.Printf("metrics: %v", err)
+		}
+	}
+}
+
+func writeMetrics(w io.Writer, sched *downloadScheduler, mayReport func(shortName string) bool) {
+	metrics.mu.Lock()
+	names := make([]string, 0, len(metrics.podcasts))
+	for name := range metrics.podcasts {
+		if mayReport(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	pms := make([]*podcastMetrics, len(names))
+	for i, name := range names {
+		pms[i] = metrics.podcasts[name]
+	}
+	metrics.mu.Unlock()
+
+	// Write a metric that has a sample for each podcast.
+	perPodcast := func(name, typ, help string, value func(*podcastMetrics) float64) {
+		writeMetricHeader(w, name, typ, help)
+		for i, pm := range pms {
+			writeSample(w, name, map[string]string{"podcast": names[i]}, value(pm))
+		}
+	}
+
+	writeMetricHeader(w, "api_calls_total", "counter", "YouTube Data API requests made.")
+	for i, pm := range pms {
+		for method := range ytAPIMethodCount {
+			writeSample(w, "api_calls_total",
+				map[string]string{"podcast": names[i], "method": ytAPIMethods[method].name},
+				float64(pm.apiCalls[method].Load()))
+		}
+	}
+	perPodcast("api_quota_units_total", "counter", "YouTube Data API quota units spent.",
+		func(pm *podcastMetrics) float64 {
+			var units uint64
+			for method := range ytAPIMethodCount {
+				units += pm.apiCalls[method].Load() * ytAPIMethods[method].quotaCost
+			}
+			return float64(units)
+		})
+	perPodcast("checks_total", "counter", "Checks for new vids made.",
+		func(pm *podcastMetrics) float64 { return float64(pm.checks.Load()) })
+	perPodcast("check_failures_total", "counter", "Checks for new vids that failed.",
+		func(pm *podcastMetrics) float64 { return float64(pm.checkFailures.Load()) })
+	perPodcast("check_duration_seconds_total", "counter", "Time spent checking for new vids.",
+		func(pm *podcastMetrics) float64 { return time.Duration(pm.checkNanos.Load()).Seconds() })
+	perPodcast("downloads_succeeded_total", "counter", "Episode downloads that succeeded.",
+		func(pm *podcastMetrics) float64 { return float64(pm.downloadsSucceeded.Load()) })
+	perPodcast("downloads_failed_total", "counter", "Episode downloads that failed.",
+		func(pm *podcastMetrics) float64 { return float64(pm.downloadsFailed.Load()) })
+	perPodcast("problem_vids", "gauge", "Vids that haven't been downloaded because of problems.",
+		func(pm *podcastMetrics) float64 { return float64(pm.problemVids.Load()) })
+	perPodcast("given_up_vids", "gauge", "Problem vids whose download has been given up on.",
+		func(pm *podcastMetrics) float64 { return float64(pm.givenUpVids.Load()) })
+	perPodcast("served_bytes_total", "counter", "Bytes of the podcast's files served.",
+		func(pm *podcastMetrics) float64 { return float64(pm.bytesServed.Load()) })
+	perPodcast("feed_last_written_timestamp_seconds", "gauge", "When the podcast's feed was last written.",
+		func(pm *podcastMetrics) float64 { return float64(pm.feedWritten.Load()) })
+
+	sched.mu.Lock()
+	queued, running := len(sched.queue), len(sched.progress)
+	sched.mu.Unlock()
+	writeMetricHeader(w, "downloads_queued", "gauge", "Episode downloads waiting for a worker.")
+	writeSample(w, "downloads_queued", nil, float64(queued))
+	writeMetricHeader(w, "downloads_running", "gauge", "Episode downloads in progress.")
+	writeSample(w, "downloads_running", nil, float64(running))
+
+	writeMetricHeader(w, "disk_available_bytes", "gauge", "Disk space available in the data directory.")
+	writeSample(w, "disk_available_bytes", nil, float64(du.NewDiskUsage(".").Available()))
+
+	if age, err := downloaderVersionAge(); err != nil {
+		log.Printf("metrics: %v", err)
+	} else {
+		writeMetricHeader(w, "downloader_version_age_seconds", "gauge", "How long ago the downloader's version was released.")
+		writeSample(w, "downloader_version_age_seconds", nil, age.Seconds())
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n", metricsPrefix, name, help)
+	fmt.Fprintf(w, "# TYPE %s%s %s\n", metricsPrefix, name, typ)
+}
+
+func writeSample(w io.Writer, name string, labels map[string]string, value float64) {
+	fmt.Fprint(w, metricsPrefix, name)
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = fmt.Sprintf(`%s="%s"`, k, metricsLabelEscaper.Replace(labels[k]))
+		}
+		fmt.Fprintf(w, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintln(w, "", value)
+}
+
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ------------------------------------------------------------
+
+// Wraps a http.ResponseWriter to count how many bytes of body are written,
+// and to remember the status code.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n      uint64
+	status int
+}
+
+func (cw *countingResponseWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// The status code of the response, which is implicitly 200 if it wasn't set
+// explicitly.
+func (cw *countingResponseWriter) statusCode() int {
+	if cw.status == 0 {
+		return http.StatusOK
+	}
+	return cw.status
+}
+
+func (cw *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
+
+// Lets http.FileServer keep using sendfile(2) where possible.
+func (cw *countingResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(cw.ResponseWriter, r)
+	cw.n += uint64(n)
+	return n, err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteSample(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		value  float64
+		want   string
+	}{
+		{"downloads_queued", nil, 3, "yt2pod_downloads_queued 3\n"},
+		{"checks_total", map[string]string{"podcast": "twib"}, 1.5, `yt2pod_checks_total{podcast="twib"} 1.5` + "\n"},
+		{"api_calls_total", map[string]string{"podcast": "twib", "method": "search.list"}, 0,
+			`yt2pod_api_calls_total{method="search.list",podcast="twib"} 0` + "\n"},
+		{"checks_total", map[string]string{"podcast": "a\"b\\c\nd"}, 1, `yt2pod_checks_total{podcast="a\"b\\c\nd"} 1` + "\n"},
+	} {
+		var b strings.Builder
+		writeSample(&b, tc.name, tc.labels, tc.value)
+		if b.String() != tc.want {
+			t.Errorf("got %q, want %q", b.String(), tc.want)
+		}
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	pm := metrics.podcast("metrics-public")
+	pm.apiCalls[ytAPISearchList].Add(2)
+	pm.apiCalls[ytAPIPlaylistItemsList].Add(3)
+	pm.checks.Add(5)
+	pm.givenUpVids.Store(1)
+	metrics.podcast("metrics-private").checks.Add(7)
+	defer metrics.removePodcast("metrics-public")
+	defer metrics.removePodcast("metrics-private")
+
+	getVersion := getDownloaderCommandVersion
+	getDownloaderCommandVersion = func() (string, error) { return "2024.05.01", nil }
+	forgetVersion := func() {
+		lastDownloaderVersionCheck.mu.Lock()
+		lastDownloaderVersionCheck.when = time.Time{}
+		lastDownloaderVersionCheck.mu.Unlock()
+	}
+	forgetVersion()
+	defer func() {
+		getDownloaderCommandVersion = getVersion
+		forgetVersion()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var b strings.Builder
+	writeMetrics(&b, newDownloadScheduler(ctx, 0, 0), func(shortName string) bool {
+		return shortName != "metrics-private"
+	})
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE yt2pod_api_calls_total counter\n",
+		`yt2pod_api_calls_total{method="search.list",podcast="metrics-public"} 2` + "\n",
+		`yt2pod_api_quota_units_total{podcast="metrics-public"} 203` + "\n",
+		`yt2pod_checks_total{podcast="metrics-public"} 5` + "\n",
+		`yt2pod_given_up_vids{podcast="metrics-public"} 1` + "\n",
+		"# TYPE yt2pod_downloads_queued gauge\n",
+		"yt2pod_downloads_queued 0\n",
+		"# TYPE yt2pod_downloader_version_age_seconds gauge\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+	if strings.Contains(out, "metrics-private") {
+		t.Errorf("metrics include private podcast")
+	}
+}
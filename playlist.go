@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// Podcasts can be based on a playlist (which may contain vids from any number
+// of channels) rather than on a single channel.
+
+func (w *watcher) getPlaylistInfo() error {
+	w.countAPICall(ytAPIPlaylistsList)
+	apiResp, err := w.ytAPI.Playlists.List([]string{"id", "snippet"}).
+		Id(w.pod.YTPlaylist).
+		MaxResults(1).
+		Do()
+	if err != nil {
+		return fmt.Errorf("%s: getting initial playlist info failed: %w", w.pod, err)
+	}
+	if n := len(apiResp.Items); n != 1 {
+		return fmt.Errorf("%s: could not find a playlist by using the ID %q", w.pod, w.pod.YTPlaylist)
+	}
+	pl := apiResp.Items[0]
+
+	w.pod.YTPlaylistTitle = html.UnescapeString(pl.Snippet.Title)
+	w.pod.YTPlaylistDescription = html.UnescapeString(pl.Snippet.Description)
+	// The channel that owns the playlist, which isn't necessarily the channel
+	// that published any of the vids in it.
+	w.pod.YTPlaylistOwner = pl.Snippet.ChannelTitle
+	w.pod.YTPlaylistOwnerID = pl.Snippet.ChannelId
+
+	w.thumbURL = bestThumbnailURL(pl.Snippet.Thumbnails)
+	return w.writeArt()
+}
+
+func bestThumbnailURL(thumbs *youtube.ThumbnailDetails) string {
+	if thumbs == nil {
+		return ""
+	}
+	for _, t := range []*youtube.Thumbnail{
+		thumbs.Maxres, thumbs.Standard, thumbs.High, thumbs.Medium, thumbs.Default,
+	} {
+		if t != nil && t.Url != "" {
+			return t.Url
+		}
+	}
+	return ""
+}
+
+// Page through the items of the playlist with ID playlistID, calling visit
+// with each vid in it and when that was published. After each page, paging
+// stops if morePages (when non-nil) returns false.
+func (w *watcher) pagePlaylistItems(
+	playlistID string,
+	visit func(item *youtube.PlaylistItem, pubd time.Time),
+	morePages func() bool,
+) error {
+	var nextPageToken string
+	for {
+		w.countAPICall(ytAPIPlaylistItemsList)
+		apiResp, err := w.ytAPI.PlaylistItems.List([]string{"snippet", "contentDetails"}).
+			PlaylistId(playlistID).
+			MaxResults(50).
+			PageToken(nextPageToken).
+			Do()
+		if err != nil {
+			// Don't hammer on the API if it's down or isn't happy.
+			w.ytAPIRespite = ytAPIRespiteUnit
+			return err
+		}
+		for _, item := range apiResp.Items {
+			if item.ContentDetails == nil || item.ContentDetails.VideoPublishedAt == "" {
+				// Private or deleted vids remain in the playlist, but without
+				// their details.
+				continue
+			}
+			pubd, err := time.Parse(time.RFC3339, item.ContentDetails.VideoPublishedAt)
+			if err != nil {
+				return err
+			}
+			visit(item, pubd)
+		}
+		nextPageToken = apiResp.NextPageToken
+		if nextPageToken == "" || (morePages != nil && !morePages()) {
+			return nil
+		}
+	}
+}
+
+// Vids can be added to a playlist regardless of when they were published, so
+// unlike with a channel, every check has to page through the entire playlist.
+// That's relatively cheap (1 quota unit per page of results) and also keeps
+// the known positions of vids up to date.
+func (w *watcher) getLatestFromPlaylist() ([]ytVidInfo, error) {
+	var latestVids []ytVidInfo
+	positions := make(map[string]int64)
+	err := w.pagePlaylistItems(w.pod.YTPlaylist, func(item *youtube.PlaylistItem, pubd time.Time) {
+		id := item.ContentDetails.VideoId
+		if _, dup := positions[id]; dup {
+			// The same vid can appear more than once in a playlist.
+			return
+		}
+		positions[id] = item.Snippet.Position
+		if w.isKnownVid(id) {
+			return
+		}
+		if !pubd.After(w.pod.Epoch) {
+			return
+		}
+		if !w.pod.TitleFilterRE.MatchString(html.UnescapeString(item.Snippet.Title)) {
+			return
+		}
+		latestVids = append(
+			latestVids,
+			makeYtVidInfo(id, pubd, item.Snippet.Title, item.Snippet.Description))
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	if w.pod.PlaylistOrder == playlistOrderPlaylist && w.knownVidsRepositioned(positions) {
+		if w.playlistPositions != nil {
+			log.Printf("%s: Playlist has been reordered", w.pod)
+		}
+		w.feedOutdated = true
+	}
+	w.playlistPositions = positions
+	w.mu.Unlock()
+	return latestVids, nil
+}
+
+// Whether positions differs from the known positions of the known vids.
+//
+// The caller must hold w.mu.
+func (w *watcher) knownVidsRepositioned(positions map[string]int64) bool {
+	for _, vi := range w.vids {
+		oldPos, hadPos := w.playlistPositions[vi.id]
+		newPos, hasPos := positions[vi.id]
+		if hadPos != hasPos || oldPos != newPos {
+			return true
+		}
+	}
+	return false
+}
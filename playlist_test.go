@@ -0,0 +1,64 @@
+package main
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestGetLatestFromPlaylist(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC) }
+	deleted := &youtube.PlaylistItem{Snippet: &youtube.PlaylistItemSnippet{Title: "Private video", Position: 2}}
+	ytAPI, requested := newTestYTAPI(t, map[string][][]*youtube.PlaylistItem{"PLexample": {
+		{
+			testPlaylistItem("ccccccccccc", "Third", 0, day(3)),
+			testPlaylistItem("aaaaaaaaaaa", "First", 1, day(1)),
+			deleted,
+		},
+		{
+			// Vids can be in a playlist more than once, and in any order of
+			// publishing.
+			testPlaylistItem("ccccccccccc", "Third", 3, day(3)),
+			testPlaylistItem("bbbbbbbbbbb", "Second", 4, day(2)),
+			testPlaylistItem("old", "Before epoch", 5, day(1)),
+		},
+	}})
+	w := &watcher{
+		ytAPI: ytAPI,
+		pod: &podcast{
+			ShortName:     "example",
+			YTPlaylist:    "PLexample",
+			PlaylistOrder: playlistOrderPlaylist,
+			Epoch:         day(1),
+			TitleFilterRE: regexp.MustCompile(""),
+		},
+		vids:              []ytVidInfo{{id: "aaaaaaaaaaa"}},
+		playlistPositions: map[string]int64{"aaaaaaaaaaa": 0},
+	}
+
+	vids, err := w.getLatestFromPlaylist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, vi := range vids {
+		ids = append(ids, vi.id)
+	}
+	if want := []string{"ccccccccccc", "bbbbbbbbbbb"}; !slices.Equal(ids, want) {
+		t.Errorf("got vids %v, want %v", ids, want)
+	}
+	if *requested != 2 {
+		t.Errorf("requested %d pages, want 2", *requested)
+	}
+	wantPositions := map[string]int64{"ccccccccccc": 0, "aaaaaaaaaaa": 1, "bbbbbbbbbbb": 4, "old": 5}
+	if !maps.Equal(w.playlistPositions, wantPositions) {
+		t.Errorf("positions %v, want %v", w.playlistPositions, wantPositions)
+	}
+	if !w.feedOutdated {
+		t.Error("feed not outdated after a known vid moved")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// A podcast can optionally have the elements of the Podcasting 2.0 namespace
+// in its feed: a GUID identifying the podcast, whether it's locked against
+// being imported by other hosting platforms, funding links to the YouTube
+// channels it's based on, the people involved in it, and, for each episode,
+// links to its chapters and transcripts (if it has those companion files).
+//
+// REF: https://podcastindex.org/namespace/1.0
+
+const podcastChaptersMIMEType = "application/json+chapters"
+
+// The GUID is a UUID (version 5) derived from the feed's URL, so that the
+// podcast can still be identified after it moves.
+//
+// REF: https://podcastindex.org/namespace/1.0#guid
+//
+//nolint:gochecknoglobals
+var podcastGUIDNamespace = uuid.MustParse("ead4c236-bf58-58c6-a2c6-a6b28d128cb6")
+
+func podcastGUID(feedURL string) string {
+	_, rest, found := strings.Cut(feedURL, "://")
+	if !found {
+		rest = feedURL
+	}
+	return uuid.NewSHA1(podcastGUIDNamespace, []byte(strings.TrimRight(rest, "/"))).String()
+}
+
+// Transcripts can only be linked to from the feed using the namespace, so a
+// podcast with subtitles uses it for its episodes regardless.
+func (p *podcast) podcastNamespaceInFeed() bool {
+	return p.PodcastNamespace || len(p.SubtitleLangs) > 0
+}
+
+func (w *watcher) addPodcastNamespaceToChannel(channel *rssChannel) {
+	channel.PodcastGUID = w.pod.PodcastGUID
+	if channel.PodcastGUID == "" {
+		// A subscriber's token isn't part of the URL, so that the GUID
+		// doesn't change if the podcast is made private.
+		channel.PodcastGUID = podcastGUID(w.buildPublicURL(w.pod.feedPath()))
+	}
+
+	locked := "no"
+	if w.pod.PodcastLocked {
+		locked = "yes"
+	}
+	channel.PodcastLocked = &podcastLocked{Owner: w.pod.ItunesOwnerEmail, Locked: locked}
+
+	if w.pod.YTPlaylist != "" {
+		channel.PodcastFunding = append(channel.PodcastFunding, &podcastFunding{
+			URL:  youtubeChannelUrlPrefix + w.pod.YTPlaylistOwnerID,
+			Text: fmt.Sprintf("Support %s on YouTube", w.pod.YTPlaylistOwner),
+		})
+	} else {
+		for i := range w.pod.YTChannels {
+			src := &w.pod.YTChannels[i]
+			channel.PodcastFunding = append(channel.PodcastFunding, &podcastFunding{
+				URL:  src.homeLink(),
+				Text: fmt.Sprintf("Support %s on YouTube", src.YTChannelReadableName),
+			})
+		}
+	}
+
+	for i := range w.pod.Persons {
+		channel.PodcastPersons = append(channel.PodcastPersons, &w.pod.Persons[i])
+	}
+}
+
+func (w *watcher) addPodcastNamespaceToItem(item *rssItem, companions []companionFile) {
+	for _, cf := range companions {
+		if cf.isChapters() {
+			item.PodcastChapters = &podcastChapters{
+				URL:  w.buildURL(cf.path),
+				Type: podcastChaptersMIMEType,
+			}
+			continue
+		}
+		transcript := &podcastTranscript{
+			URL:      w.buildURL(cf.path),
+			Type:     cf.format.mimeType,
+			Language: cf.lang,
+		}
+		if cf.format.captions {
+			transcript.Rel = "captions"
+		}
+		item.PodcastTranscripts = append(item.PodcastTranscripts, transcript)
+	}
+}
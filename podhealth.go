@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// As well as the daemon-wide health checks, each podcast has its own, so that
+// one podcast going wrong isn't hidden by the others being fine. They're
+// named SHORT_NAME/CHECK, e.g. /health/twib/stale
+//
+//   - stale: the podcast's feed hasn't been written for too long.
+//   - problems: too many of the podcast's vids have problems downloading.
+//   - api: too many consecutive checks for the podcast's new vids have failed.
+
+const (
+	defaultHealthMaxProblemVids   = 10
+	defaultHealthMaxCheckFailures = 3
+)
+
+type podcastHealth struct {
+	staleThreshold   time.Duration
+	maxProblemVids   int
+	maxCheckFailures int
+
+	feedWritten         time.Time
+	problemVids         int
+	checkFailures       int // Consecutive
+	lastCheckFailureErr error
+}
+
+type podcastHealthRegistry struct {
+	mu       sync.Mutex
+	podcasts map[string]*podcastHealth // Keyed by podcast short name
+}
+
+//nolint:gochecknoglobals
+var podcastHealths = &podcastHealthRegistry{podcasts: make(map[string]*podcastHealth)}
+
+// Register pod, or update its thresholds if it's already registered.
+func (reg *podcastHealthRegistry) setPodcast(pod *podcast) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	ph, ok := reg.podcasts[pod.ShortName]
+	if !ok {
+		// Until its feed is written, the podcast is considered to have been
+		// fine as of when it was registered.
+		ph = &podcastHealth{feedWritten: time.Now()}
+		reg.podcasts[pod.ShortName] = ph
+	}
+	ph.staleThreshold = time.Duration(pod.HealthStaleDays) * 24 * time.Hour
+	ph.maxProblemVids = pod.HealthMaxProblemVids
+	ph.maxCheckFailures = pod.HealthMaxCheckFailures
+}
+
+func (reg *podcastHealthRegistry) removePodcast(shortName string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	delete(reg.podcasts, shortName)
+}
+
+// Call f on the health of the podcast named shortName, if it's registered.
+func (reg *podcastHealthRegistry) update(shortName string, f func(*podcastHealth)) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if ph, ok := reg.podcasts[shortName]; ok {
+		f(ph)
+	}
+}
+
+func (reg *podcastHealthRegistry) resetStaleness() {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	now := time.Now()
+	for _, ph := range reg.podcasts {
+		ph.feedWritten = now
+	}
+}
+
+func (reg *podcastHealthRegistry) feedWritten(shortName string) {
+	reg.update(shortName, func(ph *podcastHealth) { ph.feedWritten = time.Now() })
+}
+
+func (reg *podcastHealthRegistry) setProblemVids(shortName string, n int) {
+	reg.update(shortName, func(ph *podcastHealth) { ph.problemVids = n })
+}
+
+func (reg *podcastHealthRegistry) checkFinished(shortName string, err error) {
+	reg.update(shortName, func(ph *podcastHealth) {
+		if err != nil {
+			ph.checkFailures++
+			ph.lastCheckFailureErr = err
+		} else {
+			ph.checkFailures = 0
+		}
+	})
+}
+
+// Returns the health checks of the podcasts for which mayReport returns true,
+// keyed by name.
+func (reg *podcastHealthRegistry) checks(mayReport func(shortName string) bool) map[string]healthFunc {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	checks := make(map[string]healthFunc, 3*len(reg.podcasts))
+	for shortName := range reg.podcasts {
+		if !mayReport(shortName) {
+			continue
+		}
+		// Look the podcast up again when checking, in case it has since been
+		// removed.
+		withHealth := func(f func(*podcastHealth) healthResult) healthFunc {
+			return func() (healthResult, error) {
+				reg.mu.Lock()
+				defer reg.mu.Unlock()
+				ph, ok := reg.podcasts[shortName]
+				if !ok {
+					return healthResult{}, fmt.Errorf("podcast %s is no longer configured", shortName)
+				}
+				return f(ph), nil
+			}
+		}
+		checks[shortName+"/stale"] = withHealth(func(ph *podcastHealth) healthResult {
+			since := time.Since(ph.feedWritten)
+			return healthResult{
+				concern:   since > ph.staleThreshold,
+				value:     since.Seconds(),
+				threshold: ph.staleThreshold.Seconds(),
+				unit:      "seconds",
+			}
+		})
+		checks[shortName+"/problems"] = withHealth(func(ph *podcastHealth) healthResult {
+			return healthResult{
+				concern:   ph.problemVids >= ph.maxProblemVids,
+				value:     float64(ph.problemVids),
+				threshold: float64(ph.maxProblemVids),
+				unit:      "vids",
+			}
+		})
+		checks[shortName+"/api"] = withHealth(func(ph *podcastHealth) healthResult {
+			res := healthResult{
+				concern:   ph.checkFailures >= ph.maxCheckFailures,
+				value:     float64(ph.checkFailures),
+				threshold: float64(ph.maxCheckFailures),
+				unit:      "consecutive failed checks",
+			}
+			if res.concern {
+				res.reason = ph.lastCheckFailureErr.Error()
+			}
+			return res
+		})
+	}
+	return checks
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPodcastHealthChecks(t *testing.T) {
+	reg := &podcastHealthRegistry{podcasts: make(map[string]*podcastHealth)}
+	for _, pod := range []*podcast{
+		{ShortName: "public", HealthStaleDays: 1, HealthMaxProblemVids: 2, HealthMaxCheckFailures: 2},
+		{ShortName: "private", HealthStaleDays: 1, HealthMaxProblemVids: 2, HealthMaxCheckFailures: 2},
+	} {
+		reg.setPodcast(pod)
+	}
+	reg.update("public", func(ph *podcastHealth) { ph.feedWritten = time.Now().Add(-48 * time.Hour) })
+	reg.setProblemVids("public", 1)
+	reg.checkFinished("public", errors.New("quota exceeded"))
+	reg.checkFinished("public", errors.New("quota exceeded"))
+
+	checks := reg.checks(func(shortName string) bool { return shortName != "private" })
+	var names []string
+	for name := range checks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if want := []string{"public/api", "public/problems", "public/stale"}; !slices.Equal(names, want) {
+		t.Fatalf("got checks %v, want %v", names, want)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		wantConcern bool
+		wantValue   float64
+		wantReason  string
+	}{
+		{"public/problems", false, 1, ""},
+		{"public/api", true, 2, "quota exceeded"},
+	} {
+		res, err := checks[tc.name]()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.concern != tc.wantConcern || res.value != tc.wantValue || res.reason != tc.wantReason {
+			t.Errorf("%s = %+v", tc.name, res)
+		}
+	}
+	if res, _ := checks["public/stale"](); !res.concern {
+		t.Errorf("feed not written for 2 days isn't stale with a 1 day threshold")
+	}
+
+	reg.checkFinished("public", nil)
+	if res, _ := checks["public/api"](); res.concern || res.value != 0 {
+		t.Errorf("successful check didn't reset failures: %+v", res)
+	}
+	reg.removePodcast("public")
+	if _, err := checks["public/stale"](); err == nil {
+		t.Errorf("no error checking a removed podcast")
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// When downloading a vid fails, the downloader's error output is used to
+// decide whether it's worth trying again, and if so, when.
+
+type downloadErrorClass int
+
+const (
+	// e.g. a network problem, or YouTube rate limiting. Retried with
+	// exponential backoff.
+	dlErrTransient downloadErrorClass = iota
+	// The vid is a scheduled premiere or live stream. Retried once it has
+	// started (if it's known when that is).
+	dlErrNotYetAvailable
+	// e.g. the vid is private. Given up on, only being retried after a long
+	// time in case it was misjudged or has changed.
+	dlErrPermanent
+)
+
+const (
+	downloadRetryBaseDelay = 15 * time.Minute
+	downloadRetryMaxDelay  = 24 * time.Hour
+	givenUpRetryDelay      = 30 * 24 * time.Hour
+	// Premieres often start a little after their scheduled time.
+	premiereStartMargin = 5 * time.Minute
+)
+
+type downloadError struct {
+	class  downloadErrorClass
+	reason string
+	// For dlErrNotYetAvailable, how long until the vid should be available,
+	// or zero if that's unknown.
+	availableIn time.Duration
+	err         error
+}
+
+func (e *downloadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *downloadError) Unwrap() error {
+	return e.err
+}
+
+// Matched against the downloader's stderr before the permanent patterns,
+// because YouTube's rate limiting can look like a vid being unavailable (e.g.
+// "Video unavailable. This content isn't available, try again later.").
+var transientDownloadErrorRE = regexp.MustCompile(
+	`(?i)try again later|isn't available|isn’t available|too many requests|HTTP Error 429|rate.?limit`)
+
+// Listed in the order they are checked. Matched against the downloader's
+// stderr.
+//
+//nolint:gochecknoglobals
+var permanentDownloadErrorPatterns = []struct {
+	re     *regexp.Regexp
+	reason string
+}{
+	{regexp.MustCompile(`(?i)members[- ]only|available to this channel's members`), "members only"},
+	{regexp.MustCompile(`(?i)private video|video is private`), "video is private"},
+	{regexp.MustCompile(`(?i)in your country|geo.?restricted`), "blocked in this country"},
+	{regexp.MustCompile(`(?i)confirm your age|age.?restricted`), "age restricted"},
+	{regexp.MustCompile(`(?i)copyright`), "removed due to a copyright claim"},
+	{regexp.MustCompile(`(?i)account .* has been terminated|video has been removed|video unavailable`), "video removed"},
+}
+
+var (
+	premiereInRE   = regexp.MustCompile(`(?i)(?:premieres|will begin|starts?) in (\d+) (minute|hour|day)s?`)
+	premiereSoonRE = regexp.MustCompile(`(?i)premiere will begin shortly|will begin in a few moments|live event will begin|upcoming live|premieres in`)
+)
+
+func classifyDownloadError(err error, stderr string) *downloadError {
+	dlErr := &downloadError{
+		class: dlErrTransient,
+		err:   fmt.Errorf("%w: %s", err, stderr),
+	}
+
+	if m := premiereInRE.FindStringSubmatch(stderr); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := map[string]time.Duration{
+			"minute": time.Minute,
+			"hour":   time.Hour,
+			"day":    24 * time.Hour,
+		}[strings.ToLower(m[2])]
+		dlErr.class = dlErrNotYetAvailable
+		dlErr.reason = "premiere or live stream that hasn't started"
+		dlErr.availableIn = time.Duration(n) * unit
+		return dlErr
+	}
+	if premiereSoonRE.MatchString(stderr) {
+		dlErr.class = dlErrNotYetAvailable
+		dlErr.reason = "premiere or live stream that hasn't started"
+		return dlErr
+	}
+	if transientDownloadErrorRE.MatchString(stderr) {
+		dlErr.reason = "transient error"
+		return dlErr
+	}
+	for _, p := range permanentDownloadErrorPatterns {
+		if p.re.MatchString(stderr) {
+			dlErr.class = dlErrPermanent
+			dlErr.reason = p.reason
+			return dlErr
+		}
+	}
+	dlErr.reason = "transient error"
+	return dlErr
+}
+
+// ------------------------------------------------------------
+
+type problemVid struct {
+	vi       ytVidInfo
+	attempts int
+	nextTry  time.Time
+	reason   string
+	givenUp  bool
+}
+
+// Record that a download attempt for pv failed, and work out when (if ever) it
+// should be tried again.
+func (pv *problemVid) failed(dlErr *downloadError) {
+	pv.attempts++
+	pv.reason = dlErr.reason
+	pv.givenUp = false
+
+	switch dlErr.class {
+	case dlErrPermanent:
+		pv.givenUp = true
+		pv.nextTry = time.Now().Add(givenUpRetryDelay)
+	case dlErrNotYetAvailable:
+		if dlErr.availableIn > 0 {
+			pv.nextTry = time.Now().Add(dlErr.availableIn + premiereStartMargin)
+			break
+		}
+		fallthrough
+	default:
+		delay := downloadRetryMaxDelay
+		if pv.attempts <= 8 {
+			delay = min(downloadRetryBaseDelay<<(pv.attempts-1), downloadRetryMaxDelay)
+		}
+		pv.nextTry = time.Now().Add(delay)
+	}
+}
+
+// Vids that were given up on are due again eventually too. (Those given up on
+// by older versions have no time to try again, so are due straight away.)
+func (pv *problemVid) due() bool {
+	return !time.Now().Before(pv.nextTry)
+}
+
+// Returns the number of problem vids that have been given up on.
+//
+// The caller must hold w.mu.
+func (w *watcher) countGivenUpVids() int {
+	var n int
+	for _, pv := range w.problemVids {
+		if pv.givenUp {
+			n++
+		}
+	}
+	return n
+}
+
+// Update what's reported about the podcast's problem vids.
+//
+// The caller must hold w.mu.
+func (w *watcher) problemsChanged() {
+	givenUp := w.countGivenUpVids()
+	setGivenUpVidCount(w.pod.ShortName, givenUp)
+	pm := metrics.podcast(w.pod.ShortName)
+	pm.problemVids.Store(int64(len(w.problemVids)))
+	pm.givenUpVids.Store(int64(givenUp))
+	podcastHealths.setProblemVids(w.pod.ShortName, len(w.problemVids))
+}
+
+// The caller must hold w.mu.
+func (w *watcher) logProblem(pv *problemVid, err error) {
+	switch {
+	case pv.givenUp:
+		log.Printf("%s: Giving up on downloading %s (%s) until %s: %v",
+			w.pod, pv.vi.id, pv.reason, pv.nextTry.Format(time.RFC3339), err)
+	case pv.attempts == 1:
+		log.Printf("%s: %s download failed (%s), will retry at %s: %v",
+			w.pod, pv.vi.id, pv.reason, pv.nextTry.Format(time.RFC3339), err)
+	default:
+		log.Printf("%s: %s download failed again (%s, attempt %d), will retry at %s",
+			w.pod, pv.vi.id, pv.reason, pv.attempts, pv.nextTry.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClassifyDownloadError(t *testing.T) {
+	for _, tc := range []struct {
+		stderr      string
+		class       downloadErrorClass
+		reason      string
+		availableIn time.Duration
+	}{
+		{
+			"ERROR: [youtube] aaaaaaaaaaa: Join this channel to get access to members-only content like this video",
+			dlErrPermanent, "members only", 0,
+		},
+		{
+			"ERROR: [youtube] aaaaaaaaaaa: Private video. Sign in if you've been granted access to this video",
+			dlErrPermanent, "video is private", 0,
+		},
+		{
+			"ERROR: [youtube] aaaaaaaaaaa: Video unavailable. This video has been removed by the uploader",
+			dlErrPermanent, "video removed", 0,
+		},
+		{
+			"ERROR: [youtube] aaaaaaaaaaa: Video unavailable. This content isn't available, try again later.",
+			dlErrTransient, "transient error", 0,
+		},
+		{
+			"ERROR: unable to download video data: HTTP Error 429: Too Many Requests",
+			dlErrTransient, "transient error", 0,
+		},
+		{
+			"ERROR: [youtube] aaaaaaaaaaa: Premieres in 2 hours",
+			dlErrNotYetAvailable, "premiere or live stream that hasn't started", 2 * time.Hour,
+		},
+		{
+			"ERROR: [youtube] aaaaaaaaaaa: This live event will begin in a few moments.",
+			dlErrNotYetAvailable, "premiere or live stream that hasn't started", 0,
+		},
+		{
+			"ERROR: unable to download video data: <urlopen error [Errno -3] Temporary failure in name resolution>",
+			dlErrTransient, "transient error", 0,
+		},
+	} {
+		got := classifyDownloadError(errors.New("exit status 1"), tc.stderr)
+		if got.class != tc.class || got.reason != tc.reason || got.availableIn != tc.availableIn {
+			t.Errorf("%q classified as (%d, %q, %v), want (%d, %q, %v)", tc.stderr,
+				got.class, got.reason, got.availableIn, tc.class, tc.reason, tc.availableIn)
+		}
+	}
+}
+
+func TestGivenUpVidsAreRetriedEventually(t *testing.T) {
+	pv := &problemVid{}
+	pv.failed(&downloadError{class: dlErrPermanent, reason: "video is private"})
+	if !pv.givenUp || pv.due() {
+		t.Fatalf("just given up on, but givenUp = %v, due = %v", pv.givenUp, pv.due())
+	}
+	pv.nextTry = time.Now().Add(-time.Second)
+	if !pv.due() {
+		t.Errorf("not due after %v", givenUpRetryDelay)
+	}
+	pv.failed(&downloadError{class: dlErrTransient, reason: "transient error"})
+	if pv.givenUp {
+		t.Errorf("still given up on after a transient failure")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The downloader is run with --newline so that it writes each progress update
+// on its own line, which is parsed to keep track of how in-flight downloads
+// are going.
+
+const (
+	httpStatusPath = "/status"
+	// Progress is logged each time a download crosses a multiple of this.
+	progressLogStepPercent = 25
+)
+
+// e.g. "[download]  45.3% of ~ 12.34MiB at  1.23MiB/s ETA 00:12"
+var downloaderProgressRE = regexp.MustCompile(
+	`^\[download\]\s+([\d.]+)%\s+of\s+~?\s*(\S+)(?:\s+at\s+(\S+))?(?:\s+ETA\s+(\S+))?`)
+
+type downloadProgress struct {
+	podcast string
+	vidID   string
+	started time.Time
+
+	mu      sync.Mutex
+	percent float64
+	size    string
+	speed   string
+	eta     string
+}
+
+// Update the progress based on a line of the downloader's output, logging if
+// a milestone has been reached. Lines that aren't progress updates are
+// ignored.
+func (p *downloadProgress) update(line string) {
+	m := downloaderProgressRE.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	percent, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prevStep := int(p.percent) / progressLogStepPercent
+	p.percent, p.size, p.speed, p.eta = percent, m[2], m[3], m[4]
+	if step := int(percent) / progressLogStepPercent; step > prevStep && percent < 100 {
+		log.Printf("%s: %s download progress: %.0f%% of %s at %s, ETA %s",
+			p.podcast, p.vidID, percent, p.size, p.speed, p.eta)
+	}
+}
+
+type downloadProgressStatus struct {
+	Podcast        string  `json:"podcast"`
+	VidID          string  `json:"vid_id"`
+	ElapsedSeconds int     `json:"elapsed_seconds"`
+	Percent        float64 `json:"percent"`
+	Size           string  `json:"size,omitempty"`
+	Speed          string  `json:"speed,omitempty"`
+	ETA            string  `json:"eta,omitempty"`
+}
+
+func (p *downloadProgress) status() downloadProgressStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return downloadProgressStatus{
+		Podcast:        p.podcast,
+		VidID:          p.vidID,
+		ElapsedSeconds: int(time.Since(p.started).Seconds()),
+		Percent:        p.percent,
+		Size:           p.size,
+		Speed:          p.speed,
+		ETA:            p.eta,
+	}
+}
+
+// ------------------------------------------------------------
+
+// Serve a JSON summary of what the download scheduler is doing. Private
+// podcasts' downloads are only included if the request carries one of their
+// tokens.
+func (s *downloadScheduler) statusHandler(w http.ResponseWriter, r *http.Request) {
+	mayReport := podcastAccessControl.reportFilter(r)
+	s.mu.Lock()
+	status := struct {
+		Queued      int                      `json:"queued"`
+		Downloading []downloadProgressStatus `json:"downloading"`
+	}{
+		Queued:      len(s.queue),
+		Downloading: make([]downloadProgressStatus, 0, len(s.progress)),
+	}
+	for _, p := range s.progress {
+		status.Downloading = append(status.Downloading, p.status())
+	}
+	s.mu.Unlock()
+	status.Downloading = slices.DeleteFunc(status.Downloading, func(ps downloadProgressStatus) bool {
+		return !mayReport(ps.Podcast)
+	})
+
+	sort.Slice(status.Downloading, func(i, j int) bool {
+		return status.Downloading[i].ElapsedSeconds > status.Downloading[j].ElapsedSeconds
+	})
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(status); err != nil {
+		log.Printf("status: %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zyedidia/generic/mapset"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+// The config file can be reloaded while the daemon is running (on Unix, by
+// sending it SIGHUP). Podcasts that have been added or removed have their
+// watchers started or stopped. Podcasts that have been changed have their
+// watchers reconfigured, or if the change is too fundamental for that,
+// restarted. Changes to the top-level settings only take effect after the
+// daemon is restarted.
+
+type watcherSet struct {
+	ctx context.Context
+	// The config the daemon was started with.
+	cfg   *config
+	sched *downloadScheduler
+
+	mu       sync.Mutex
+	watchers map[string]*watcher // Keyed by podcast short name
+	// Once stopped, reloading does nothing.
+	stopped bool
+}
+
+func newWatcherSet(ctx context.Context, cfg *config, sched *downloadScheduler) *watcherSet {
+	return &watcherSet{
+		ctx:      ctx,
+		cfg:      cfg,
+		sched:    sched,
+		watchers: make(map[string]*watcher),
+	}
+}
+
+// Create a watcher for pod and start it watching.
+//
+// The caller must hold ws.mu.
+func (ws *watcherSet) start(pod *podcast, cleanc chan *cleaningWhitelist) error {
+	ytAPI, err := youtube.NewService(context.Background(), option.WithAPIKey(ws.cfg.YTDataAPIKey))
+	if err != nil {
+		return err
+	}
+	wat, err := newWatcher(ws.ctx, ytAPI, ws.cfg, pod, ws.sched, cleanc)
+	if err != nil {
+		wat.stop()
+		return err
+	}
+	ws.watchers[pod.ShortName] = wat
+	go wat.watch()
+	return nil
+}
+
+func (ws *watcherSet) reload(configPath string) {
+	newCfg, err := loadConfig(configPath)
+	if err == nil {
+		// The working directory is the data directory.
+		err = newCfg.checkSecretsOutside(".")
+	}
+	if err != nil {
+		log.Printf("Config reload rejected: %v", err)
+		return
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.stopped {
+		return
+	}
+
+	oldTop, newTop := *ws.cfg, *newCfg
+	oldTop.Podcasts, newTop.Podcasts = nil, nil
+	if !reflect.DeepEqual(oldTop, newTop) {
+		log.Print("Changes to top-level config settings will only take effect after a restart")
+	}
+
+	newShortNames := mapset.New[string]()
+	for i := range newCfg.Podcasts {
+		newShortNames.Put(newCfg.Podcasts[i].ShortName)
+	}
+	for name, wat := range ws.watchers {
+		if !newShortNames.Has(name) {
+			log.Printf("%s: Stopping watcher because podcast was removed from config", wat.pod)
+			wat.stop()
+			delete(ws.watchers, name)
+			setGivenUpVidCount(name, 0)
+			podcastAccessControl.removePodcast(name)
+			metrics.removePodcast(name)
+			podcastHealths.removePodcast(name)
+		}
+	}
+
+	for i := range newCfg.Podcasts {
+		newPod := &newCfg.Podcasts[i]
+		wat, exists := ws.watchers[newPod.ShortName]
+		switch {
+		case !exists:
+			log.Printf("%s: Starting watcher because podcast was added to config", newPod)
+		case restartRequired(wat.pod, newPod):
+			log.Printf("%s: Restarting watcher because podcast's sources or format changed in config", newPod)
+			// The old watcher is only stopped once its replacement has been
+			// created, so that the podcast isn't left without one if that
+			// fails.
+			newWat, err := newWatcher(ws.ctx, wat.ytAPI, ws.cfg, newPod, ws.sched, nil)
+			if err != nil {
+				newWat.stop()
+				wat.register()
+				log.Printf("%s: Restarting watcher failed, so keeping the old one: %v", newPod, err)
+				continue
+			}
+			wat.stop()
+			ws.watchers[newPod.ShortName] = newWat
+			go newWat.watch()
+			continue
+		default:
+			wat.reconfigureLater(newPod)
+			continue
+		}
+		if err := ws.start(newPod, nil); err != nil {
+			log.Printf("%s: Starting watcher failed: %v", newPod, err)
+		}
+	}
+	log.Print("Config successfully reloaded from ", configPath)
+}
+
+// Register w's podcast again with everything that keeps track of podcasts,
+// after a replacement watcher that failed to start took its place.
+func (w *watcher) register() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sched.setCap(w, w.pod.MaxConcurrentDownloads)
+	podcastAccessControl.setPodcast(w.pod)
+	podcastHealths.setPodcast(w.pod)
+	w.problemsChanged()
+}
+
+// Stop all the watchers, waiting for any feed writes they have in progress
+// to finish.
+func (ws *watcherSet) stopAll() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for _, wat := range ws.watchers {
+		wat.stop()
+	}
+	ws.stopped = true
+}
+
+// Whether changing a podcast's config from old to new is too fundamental a
+// change for its watcher to be reconfigured in place.
+func restartRequired(old, new *podcast) bool {
+	if old.YTPlaylist != new.YTPlaylist ||
+		old.Video != new.Video ||
+		old.Discovery != new.Discovery ||
+		len(old.YTChannels) != len(new.YTChannels) {
+		return true
+	}
+	for i := range old.YTChannels {
+		if old.YTChannels[i].YTChannelHandle != new.YTChannels[i].YTChannelHandle {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------------------------------------------
+
+// Have the watch goroutine apply newPod the next time it's sleeping between
+// checks.
+func (w *watcher) reconfigureLater(newPod *podcast) {
+	// Any config that has been sent but not yet applied is superseded.
+	select {
+	case <-w.reconfigc:
+	default:
+	}
+	w.reconfigc <- newPod
+}
+
+// Apply the parts of newPod that can be changed without restarting the
+// watcher. Only the watch goroutine calls this.
+func (w *watcher) reconfigure(newPod *podcast) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+
+	pod := w.pod
+	interestChanged := pod.EpochStr != newPod.EpochStr ||
+		pod.TitleFilter != newPod.TitleFilter ||
+		!slices.Equal(pod.sourcesSignature(), newPod.sourcesSignature())
+	artChanged := pod.CustomImagePath != newPod.CustomImagePath
+	// Whether a podcast is private changes its URLs.
+	feedChanged := pod.Name != newPod.Name ||
+		pod.Description != newPod.Description ||
+		pod.PlaylistOrder != newPod.PlaylistOrder ||
+		pod.isPrivate() != newPod.isPrivate() ||
+		pod.ItunesCategory != newPod.ItunesCategory ||
+		pod.ItunesOwnerName != newPod.ItunesOwnerName ||
+		pod.ItunesOwnerEmail != newPod.ItunesOwnerEmail ||
+		pod.Explicit != newPod.Explicit ||
+		pod.PodcastNamespace != newPod.PodcastNamespace ||
+		pod.PodcastGUID != newPod.PodcastGUID ||
+		pod.PodcastLocked != newPod.PodcastLocked ||
+		!reflect.DeepEqual(pod.Persons, newPod.Persons) ||
+		pod.keepsLegacyGUIDs() != newPod.keepsLegacyGUIDs() ||
+		artChanged
+	accessChanged := !reflect.DeepEqual(pod.AccessTokens, newPod.AccessTokens) ||
+		pod.AccessTokensFile != newPod.AccessTokensFile
+	healthChanged := pod.HealthStaleDays != newPod.HealthStaleDays ||
+		pod.HealthMaxProblemVids != newPod.HealthMaxProblemVids ||
+		pod.HealthMaxCheckFailures != newPod.HealthMaxCheckFailures
+	if !interestChanged && !feedChanged && !accessChanged && !healthChanged &&
+		pod.MaxConcurrentDownloads == newPod.MaxConcurrentDownloads &&
+		pod.EmbedChapters == newPod.EmbedChapters &&
+		slices.Equal(pod.SubtitleLangs, newPod.SubtitleLangs) {
+		return
+	}
+	log.Printf("%s: Applying changed config", pod)
+
+	pod.Name = newPod.Name
+	pod.Description = newPod.Description
+	pod.PlaylistOrder = newPod.PlaylistOrder
+	pod.CustomImagePath = newPod.CustomImagePath
+	pod.ItunesCategory = newPod.ItunesCategory
+	pod.ItunesOwnerName = newPod.ItunesOwnerName
+	pod.ItunesOwnerEmail = newPod.ItunesOwnerEmail
+	pod.Explicit = newPod.Explicit
+	pod.PodcastNamespace = newPod.PodcastNamespace
+	pod.PodcastGUID = newPod.PodcastGUID
+	pod.PodcastLocked = newPod.PodcastLocked
+	pod.Persons = newPod.Persons
+	pod.LegacyGUIDs = newPod.LegacyGUIDs
+	pod.TitleFilter = newPod.TitleFilter
+	pod.TitleFilterRE = newPod.TitleFilterRE
+	pod.TitleFilterIsLiteral = newPod.TitleFilterIsLiteral
+	pod.EpochStr = newPod.EpochStr
+	pod.Epoch = newPod.Epoch
+	for i := range pod.YTChannels {
+		src, newSrc := &pod.YTChannels[i], &newPod.YTChannels[i]
+		src.TitleFilter = newSrc.TitleFilter
+		src.TitleFilterRE = newSrc.TitleFilterRE
+		src.TitleFilterIsLiteral = newSrc.TitleFilterIsLiteral
+	}
+	pod.MaxConcurrentDownloads = newPod.MaxConcurrentDownloads
+	pod.EmbedChapters = newPod.EmbedChapters
+	pod.SubtitleLangs = newPod.SubtitleLangs
+	pod.AccessTokens = newPod.AccessTokens
+	pod.AccessTokensFile = newPod.AccessTokensFile
+	if accessChanged {
+		podcastAccessControl.setPodcast(pod)
+	}
+	pod.HealthStaleDays = newPod.HealthStaleDays
+	pod.HealthMaxProblemVids = newPod.HealthMaxProblemVids
+	pod.HealthMaxCheckFailures = newPod.HealthMaxCheckFailures
+	if healthChanged {
+		podcastHealths.setPodcast(pod)
+	}
+
+	if interestChanged {
+		// Which of the known vids are of interest can't be determined after
+		// the fact, so start from scratch. Episodes that have already been
+		// downloaded don't need downloading again.
+		log.Printf("%s: Epoch or title filter changed, so checking for vids from scratch", pod)
+		w.sched.forget(w)
+		w.vids = nil
+		w.playlistPositions = nil
+		w.pendingVids = mapset.New[string]()
+		w.problemVids = make(map[string]*problemVid)
+		w.lastChecked = time.Time{}
+		w.problemsChanged()
+		// The feed will be rewritten once the check is done, rather than
+		// being emptied in the meantime.
+		w.feedOutdated = true
+	}
+	w.sched.setCap(w, pod.MaxConcurrentDownloads)
+
+	if artChanged {
+		if err := w.writeArt(); err != nil {
+			log.Printf("%s: Writing art failed: %v", pod, err)
+		}
+	}
+	if feedChanged && !interestChanged {
+		w.writeFeedAndLog()
+	}
+	if err := w.saveState(); err != nil {
+		log.Printf("%s: Saving state failed: %v", pod, err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRestartRequired(t *testing.T) {
+	channel := func(handle string) channelSource { return channelSource{YTChannelHandle: handle} }
+	base := podcast{YTChannels: []channelSource{channel("a"), channel("b")}, Discovery: discoveryPlaylist}
+	for _, tc := range []struct {
+		name   string
+		change func(p *podcast)
+		want   bool
+	}{
+		{"nothing", func(p *podcast) {}, false},
+		{"name", func(p *podcast) { p.Name = "New name" }, false},
+		{"title filter", func(p *podcast) { p.YTChannels[0].TitleFilter = "podcast" }, false},
+		{"video", func(p *podcast) { p.Video = true }, true},
+		{"discovery", func(p *podcast) { p.Discovery = discoveryFeed }, true},
+		{"channel replaced", func(p *podcast) { p.YTChannels[1] = channel("c") }, true},
+		{"channel added", func(p *podcast) { p.YTChannels = append(p.YTChannels, channel("c")) }, true},
+		{"playlist instead", func(p *podcast) { p.YTChannels, p.YTPlaylist = nil, "PLexample" }, true},
+	} {
+		changed := base
+		changed.YTChannels = append([]channelSource(nil), base.YTChannels...)
+		tc.change(&changed)
+		if got := restartRequired(&base, &changed); got != tc.want {
+			t.Errorf("%s: restart required = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	newPodcast := func() *podcast {
+		return &podcast{
+			ShortName:     "example",
+			Name:          "Example",
+			TitleFilterRE: regexp.MustCompile(""),
+			YTChannels: []channelSource{{
+				YTChannelHandle: "UCabcdefghijklmnopqrstuv",
+				YTChannelID:     "UCabcdefghijklmnopqrstuv",
+				TitleFilterRE:   regexp.MustCompile(""),
+			}},
+			HealthStaleDays:        1,
+			HealthMaxProblemVids:   1,
+			HealthMaxCheckFailures: 1,
+		}
+	}
+	for _, tc := range []struct {
+		name           string
+		change         func(p *podcast)
+		wantVidsKept   bool
+		wantFeedUpdate bool
+	}{
+		{"nothing", func(p *podcast) {}, true, false},
+		{"name", func(p *podcast) { p.Name = "New name" }, true, true},
+		{"max concurrent downloads", func(p *podcast) { p.MaxConcurrentDownloads = 2 }, true, false},
+		// Which vids are of interest has to be worked out again, and the feed
+		// is only rewritten once that's done.
+		{"title filter", func(p *podcast) {
+			p.TitleFilter = "podcast"
+			p.TitleFilterRE = regexp.MustCompile("podcast")
+		}, false, false},
+		{"epoch", func(p *podcast) {
+			p.EpochStr = "2024-01-01"
+			p.Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		}, false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			for _, dir := range []string{dataSubdirMetadata, dataSubdirEpisodes} {
+				if err := os.Mkdir(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			w := newTestWatcher(newPodcast())
+			w.ctx = ctx
+			w.sched = newDownloadScheduler(ctx, 0, 0)
+			lastChecked := time.Now().Add(-time.Hour)
+			w.vids = []ytVidInfo{{id: "aaaaaaaaaaa", published: lastChecked}}
+			w.lastChecked = lastChecked
+
+			newPod := newPodcast()
+			tc.change(newPod)
+			w.reconfigure(newPod)
+
+			if kept := len(w.vids) == 1 && w.lastChecked.Equal(lastChecked); kept != tc.wantVidsKept {
+				t.Errorf("vids kept = %v, want %v", kept, tc.wantVidsKept)
+			}
+			if !tc.wantVidsKept && !w.feedOutdated {
+				t.Error("feed not outdated after checking from scratch")
+			}
+			_, err := os.Stat(w.pod.feedPath())
+			if wrote := err == nil; wrote != tc.wantFeedUpdate {
+				t.Errorf("feed written = %v, want %v", wrote, tc.wantFeedUpdate)
+			}
+			if w.pod.Name != newPod.Name || w.pod.MaxConcurrentDownloads != newPod.MaxConcurrentDownloads ||
+				w.pod.TitleFilter != newPod.TitleFilter || !w.pod.Epoch.Equal(newPod.Epoch) {
+				t.Errorf("config not applied: %+v", w.pod)
+			}
+		})
+	}
+	podcastAccessControl.removePodcast("example")
+	podcastHealths.removePodcast("example")
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// All watchers share a single scheduler for downloading vids, so that the
+// number of downloader processes running at once is bounded no matter how many
+// podcasts are configured, and so that one podcast doing a big backfill
+// doesn't hold up the others.
+//
+// Podcasts can have vids in common, and a watcher that's been replaced (when
+// the config is reloaded) may still be downloading one when its replacement
+// wants it too. There's only ever one job for each episode file, so that two
+// downloads can't trample over each other's partial files, and every watcher
+// that wants the vid is told when it finishes.
+
+type downloadJob struct {
+	key downloadJobKey
+	// The first is the one whose settings the download uses (until it's
+	// running, the first may be forgotten).
+	subscribers []downloadSubscriber
+	// Set once the job is running.
+	runner *watcher
+}
+
+type downloadSubscriber struct {
+	w        *watcher
+	vi       ytVidInfo
+	firstTry bool
+}
+
+// Identifies the episode file that a job produces.
+type downloadJobKey struct {
+	id      string
+	fileExt string
+}
+
+type downloadScheduler struct {
+	// When this is done, in-flight downloads are cancelled and no more jobs
+	// are started.
+	ctx context.Context
+	// Per-download deadline, or zero for none.
+	timeout time.Duration
+	workers sync.WaitGroup
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	queue []*downloadJob
+	// Jobs that are either queued or running, to avoid duplicates.
+	active map[downloadJobKey]*downloadJob
+	// How many jobs are running for each watcher, and how many are allowed
+	// to (if there's a limit).
+	running map[*watcher]int
+	caps    map[*watcher]int
+	// The progress of each running job.
+	progress map[downloadJobKey]*downloadProgress
+}
+
+func newDownloadScheduler(ctx context.Context, workerCount int, timeout time.Duration) *downloadScheduler {
+	s := downloadScheduler{
+		ctx:      ctx,
+		timeout:  timeout,
+		active:   make(map[downloadJobKey]*downloadJob),
+		running:  make(map[*watcher]int),
+		caps:     make(map[*watcher]int),
+		progress: make(map[downloadJobKey]*downloadProgress),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.workers.Add(workerCount)
+	for i := 0; i < workerCount; i++ {
+		go s.work()
+	}
+	go func() {
+		<-ctx.Done()
+		// Wake idle workers so that they notice.
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}()
+	return &s
+}
+
+// Block until all workers have finished, which happens once the scheduler's
+// context is done and any in-flight downloads have been cancelled and cleaned
+// up after.
+func (s *downloadScheduler) wait() {
+	s.workers.Wait()
+}
+
+// Queue vi to be downloaded for w. If its episode file is already queued or
+// being downloaded, w is just told when that finishes too.
+//
+// The caller must hold w.mu.
+func (s *downloadScheduler) enqueue(w *watcher, vi ytVidInfo, firstTry bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := downloadJobKey{vi.id, w.fileExtension()}
+	sub := downloadSubscriber{w: w, vi: vi, firstTry: firstTry}
+	if job, ok := s.active[key]; ok {
+		if !slices.ContainsFunc(job.subscribers, func(sub downloadSubscriber) bool { return sub.w == w }) {
+			job.subscribers = append(job.subscribers, sub)
+		}
+		return
+	}
+	job := &downloadJob{key: key, subscribers: []downloadSubscriber{sub}}
+	s.active[key] = job
+	s.queue = append(s.queue, job)
+	s.cond.Signal()
+}
+
+// Limit how many of w's jobs can run at once. Zero means no limit.
+func (s *downloadScheduler) setCap(w *watcher, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit > 0 {
+		s.caps[w] = limit
+	} else {
+		delete(s.caps, w)
+	}
+	s.cond.Broadcast()
+}
+
+// Unsubscribe w from jobs, removing queued jobs that no other watcher wants.
+// Running jobs are left to finish.
+func (s *downloadScheduler) forget(w *watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.active {
+		job.subscribers = slices.DeleteFunc(job.subscribers, func(sub downloadSubscriber) bool {
+			return sub.w == w
+		})
+	}
+	s.queue = slices.DeleteFunc(s.queue, func(job *downloadJob) bool {
+		if len(job.subscribers) == 0 {
+			delete(s.active, job.key)
+			return true
+		}
+		return false
+	})
+	delete(s.caps, w)
+	// A job held back by w's cap may now be led by another watcher.
+	s.cond.Broadcast()
+}
+
+func (s *downloadScheduler) work() {
+	defer s.workers.Done()
+	for {
+		job, lead, prog := s.next()
+		if job == nil {
+			return
+		}
+
+		ctx, cancel := s.ctx, context.CancelFunc(func() {})
+		if s.timeout > 0 {
+			ctx, cancel = context.WithTimeout(s.ctx, s.timeout)
+		}
+		err := lead.w.download(ctx, lead.vi, lead.firstTry, prog)
+		cancel()
+
+		s.mu.Lock()
+		if s.running[job.runner]--; s.running[job.runner] == 0 {
+			delete(s.running, job.runner)
+		}
+		delete(s.active, job.key)
+		delete(s.progress, job.key)
+		// Watchers may have subscribed while it ran.
+		subscribers := slices.Clone(job.subscribers)
+		// Finishing this job might make a job that was held back by its
+		// watcher's cap eligible to run.
+		s.cond.Broadcast()
+		s.mu.Unlock()
+
+		if s.ctx.Err() != nil {
+			// The download was interrupted rather than having failed, so the
+			// vid will be tried again after the next startup.
+			return
+		}
+		for _, sub := range subscribers {
+			sub.w.downloadFinished(sub.vi, err)
+		}
+	}
+}
+
+// Block until there is a job that can be run, then take it off the queue,
+// returning it along with the subscriber whose settings it's run with. If the
+// scheduler's context is done, nil is returned instead.
+func (s *downloadScheduler) next() (*downloadJob, downloadSubscriber, *downloadProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.ctx.Err() == nil {
+		if i := s.pick(); i >= 0 {
+			job := s.queue[i]
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			lead := job.subscribers[0]
+			job.runner = lead.w
+			s.running[job.runner]++
+			prog := &downloadProgress{
+				podcast: lead.w.pod.ShortName,
+				vidID:   job.key.id,
+				started: time.Now(),
+			}
+			s.progress[job.key] = prog
+			return job, lead, prog
+		}
+		s.cond.Wait()
+	}
+	return nil, downloadSubscriber{}, nil
+}
+
+// Return the index of the highest priority job in the queue that isn't held
+// back by its watcher's cap, or -1 if there's no such job. The newest vids are
+// the highest priority, since they're what subscribers are most likely to be
+// waiting on.
+func (s *downloadScheduler) pick() int {
+	best := -1
+	for i, job := range s.queue {
+		lead := job.subscribers[0]
+		if limit, capped := s.caps[lead.w]; capped && s.running[lead.w] >= limit {
+			continue
+		}
+		if best < 0 || lead.vi.published.After(s.queue[best].subscribers[0].vi.published) {
+			best = i
+		}
+	}
+	return best
+}
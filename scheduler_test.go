@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDownloadSchedulerSharesJobs(t *testing.T) {
+	s := newDownloadScheduler(context.Background(), 0, 0)
+	cfg := &config{YTDLWriteExt: "m4a", YTDLVideoWriteExt: "mp4"}
+	audio1 := &watcher{cfg: cfg, pod: &podcast{ShortName: "audio1"}}
+	audio2 := &watcher{cfg: cfg, pod: &podcast{ShortName: "audio2"}}
+	video := &watcher{cfg: cfg, pod: &podcast{ShortName: "video", Video: true}}
+	vi := ytVidInfo{id: "aaaaaaaaaaa"}
+
+	s.enqueue(audio1, vi, true)
+	s.enqueue(audio2, vi, true)
+	s.enqueue(audio2, vi, false)
+	s.enqueue(video, vi, true)
+	if len(s.queue) != 2 {
+		t.Fatalf("%d jobs queued, want one per episode file", len(s.queue))
+	}
+	audioJob := s.active[downloadJobKey{vi.id, "m4a"}]
+	if audioJob == nil || len(audioJob.subscribers) != 2 {
+		t.Fatalf("audio job = %+v, want both audio watchers subscribed", audioJob)
+	}
+
+	// Once its first subscriber is forgotten, the job is run with the other's
+	// settings.
+	s.forget(audio1)
+	if len(audioJob.subscribers) != 1 || audioJob.subscribers[0].w != audio2 {
+		t.Errorf("after forgetting audio1, subscribers = %+v", audioJob.subscribers)
+	}
+	s.forget(audio2)
+	if len(s.queue) != 1 || s.active[downloadJobKey{vi.id, "m4a"}] != nil {
+		t.Errorf("job with no subscribers is still queued")
+	}
+
+	// A running job takes new subscribers, but isn't duplicated.
+	job, lead, _ := s.next()
+	if job == nil || lead.w != video {
+		t.Fatalf("next job = %+v led by %v, want the video job", job, lead.w)
+	}
+	s.enqueue(video, vi, false)
+	s.enqueue(audio1, ytVidInfo{id: "bbbbbbbbbbb"}, true)
+	if len(s.queue) != 1 || len(job.subscribers) != 1 {
+		t.Errorf("queue = %d jobs, running job subscribers = %+v", len(s.queue), job.subscribers)
+	}
+}
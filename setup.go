@@ -65,6 +65,12 @@ func setup() (*config, error) {
 		fmt.Println("Version:", ownVersion)
 		os.Exit(0)
 	}
+	if *flagPrintStats {
+		if err := printStatsReport(os.Stdout, filepath.Join(*flagDataPath, statsPath)); err != nil {
+			return nil, err
+		}
+		os.Exit(0)
+	}
 
 	// Setup log destination & format.
 	var (
@@ -93,6 +99,7 @@ func setup() (*config, error) {
 		return nil, errors.New("config: " + err.Error())
 	}
 	log.Print("Config successfully loaded from ", *flagConfigPath)
+	configureHealth(cfg)
 
 	// Store a closure over cfg, so that the `downloaderOld` health check can also make use of this function.
 	getDownloaderCommandVersion = func() (string, error) {
@@ -130,10 +137,18 @@ func setup() (*config, error) {
 	if err != nil && !os.IsExist(err) {
 		return nil, err
 	}
+	// The config file will be reloaded after changing directory, so make sure
+	// its path doesn't depend on the working directory.
+	if absConfigPath, err := filepath.Abs(*flagConfigPath); err == nil {
+		*flagConfigPath = absConfigPath
+	}
 	// Change into it (don't want to expose our config file when webserving).
 	if err := os.Chdir(*flagDataPath); err != nil {
 		return nil, err
 	}
+	if err := cfg.checkSecretsOutside("."); err != nil {
+		return nil, errors.New("config: " + err.Error())
+	}
 	// Create its subdirectories.
 	for _, name := range []string{dataSubdirMetadata, dataSubdirEpisodes} {
 		err := os.Mkdir(name, stdext.OwnerWritableDir)
@@ -141,9 +156,13 @@ func setup() (*config, error) {
 			return nil, err
 		}
 	}
+	if err := removeStalePartialEpisodes(); err != nil {
+		return nil, err
+	}
 
 	xplatform.RegisterStalenessResetter(func() {
 		lastTimeAnyFeedWritten.Set(time.Now())
+		podcastHealths.resetStaleness()
 		log.Print("The clock for stale feeds was reset")
 	})
 
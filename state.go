@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/frou/stdext"
+)
+
+// Each watcher persists what it knows about its podcast's episodes to a file
+// in the data directory. This means that after a restart, the first check
+// only needs to ask the YouTube API about vids published since the last check
+// before the restart, rather than about every vid since the epoch.
+
+// Bump this if a change is made to podcastState that older versions of the
+// program would misinterpret. Adding fields that are fine to be missing when
+// loading does not require a bump.
+const podcastStateVersion = 1
+
+type podcastState struct {
+	Version int `json:"version"`
+
+	// These record the config the state was built with. If the config has
+	// since changed in a way that affects which vids are of interest, the
+	// state can't be relied upon.
+	EpochStr    string   `json:"epoch"`
+	TitleFilter string   `json:"title_filter"`
+	Sources     []string `json:"sources,omitempty"`
+
+	LastChecked time.Time  `json:"last_checked"`
+	Vids        []vidState `json:"vids"`
+
+	// The URL-based GUIDs that episodes were published with, keyed by vid ID.
+	// These don't depend on the config, so are kept even when the rest of
+	// the state is disregarded.
+	LegacyGUIDs map[string]string `json:"legacy_guids,omitempty"`
+}
+
+type vidState struct {
+	ID         string    `json:"id"`
+	Published  time.Time `json:"published"`
+	Title      string    `json:"title"`
+	Desc       string    `json:"desc"`
+	Downloaded bool      `json:"downloaded"`
+
+	// Absent if the vid's details were never fetched.
+	DurationSecs  float64 `json:"duration_secs,omitempty"`
+	Thumbnail     string  `json:"thumbnail,omitempty"`
+	AgeRestricted bool    `json:"age_restricted,omitempty"`
+
+	// Only present for podcasts based on a playlist.
+	PlaylistPosition *int64 `json:"playlist_position,omitempty"`
+
+	// Only relevant when not Downloaded.
+	Attempts int       `json:"attempts,omitempty"`
+	NextTry  time.Time `json:"next_try,omitzero"`
+	Problem  string    `json:"problem,omitempty"`
+	GivenUp  bool      `json:"given_up,omitempty"`
+}
+
+func (p *podcast) statePath() string {
+	return filepath.Join(dataSubdirMetadata, p.ShortName+".state.json")
+}
+
+// ------------------------------------------------------------
+
+func (w *watcher) loadState() error {
+	buf, err := os.ReadFile(w.pod.statePath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var st podcastState
+	if err := json.Unmarshal(buf, &st); err != nil {
+		return err
+	}
+
+	switch {
+	case st.Version < 1:
+		return fmt.Errorf("state file has invalid version %d", st.Version)
+	case st.Version > podcastStateVersion:
+		return fmt.Errorf("state file has version %d, which is newer than this program understands (%d)",
+			st.Version, podcastStateVersion)
+	}
+	maps.Copy(w.legacyGUIDs, st.LegacyGUIDs)
+	if st.EpochStr != w.pod.EpochStr || st.TitleFilter != w.pod.TitleFilter {
+		log.Printf("%s: Epoch or title filter has changed since state was saved, so disregarding it", w.pod)
+		return nil
+	}
+	// State saved by older versions doesn't record its sources.
+	if st.Sources != nil && !slices.Equal(st.Sources, w.pod.sourcesSignature()) {
+		log.Printf("%s: Channels or playlist have changed since state was saved, so disregarding it", w.pod)
+		return nil
+	}
+
+	var missing int
+	for _, vs := range st.Vids {
+		vi := ytVidInfo{
+			id:        vs.ID,
+			published: vs.Published,
+			title:     vs.Title,
+			desc:      vs.Desc,
+			vidDetails: vidDetails{
+				duration:      time.Duration(vs.DurationSecs * float64(time.Second)),
+				thumbnail:     vs.Thumbnail,
+				ageRestricted: vs.AgeRestricted,
+			},
+		}
+		w.vids = append(w.vids, vi)
+		if vs.PlaylistPosition != nil {
+			if w.playlistPositions == nil {
+				w.playlistPositions = make(map[string]int64)
+			}
+			w.playlistPositions[vi.id] = *vs.PlaylistPosition
+		}
+		if vs.Downloaded {
+			if _, err := os.Stat(vi.episodePath(w.fileExtension())); err == nil {
+				continue
+			}
+			// The episode file has since been deleted (or the podcast has
+			// switched between audio and video), so download it again.
+			missing++
+			w.problemVids[vi.id] = &problemVid{vi: vi, reason: "episode file missing"}
+		} else {
+			// Includes vids that were still waiting for their first download
+			// attempt when the state was saved.
+			w.problemVids[vi.id] = &problemVid{
+				vi:       vi,
+				attempts: vs.Attempts,
+				nextTry:  vs.NextTry,
+				reason:   vs.Problem,
+				givenUp:  vs.GivenUp,
+			}
+		}
+	}
+	w.problemsChanged()
+	if missing > 0 {
+		log.Printf("%s: %d downloaded episodes' files are missing, so will download them again", w.pod, missing)
+	}
+	w.lastChecked = st.LastChecked
+	log.Printf("%s: Restored state of %d vids (%d with problems) last checked at %s",
+		w.pod, len(w.vids), len(w.problemVids), w.lastChecked.Format(time.RFC3339))
+	return nil
+}
+
+// The caller must hold w.mu.
+func (w *watcher) saveState() error {
+	st := podcastState{
+		Version:     podcastStateVersion,
+		EpochStr:    w.pod.EpochStr,
+		TitleFilter: w.pod.TitleFilter,
+		Sources:     w.pod.sourcesSignature(),
+		LastChecked: w.lastChecked,
+		Vids:        make([]vidState, 0, len(w.vids)),
+		LegacyGUIDs: w.legacyGUIDs,
+	}
+	for _, vi := range w.vids {
+		vs := vidState{
+			ID:        vi.id,
+			Published: vi.published,
+			Title:     vi.title,
+			Desc:      vi.desc,
+
+			DurationSecs:  vi.duration.Seconds(),
+			Thumbnail:     vi.thumbnail,
+			AgeRestricted: vi.ageRestricted,
+		}
+		if pos, ok := w.playlistPositions[vi.id]; ok {
+			vs.PlaylistPosition = &pos
+		}
+		if pv, isProblem := w.problemVids[vi.id]; isProblem {
+			vs.Attempts = pv.attempts
+			vs.NextTry = pv.nextTry
+			vs.Problem = pv.reason
+			vs.GivenUp = pv.givenUp
+		} else {
+			vs.Downloaded = !w.pendingVids.Has(vi.id)
+		}
+		st.Vids = append(st.Vids, vs)
+	}
+	buf, err := json.MarshalIndent(st, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(w.pod.statePath(), buf)
+}
+
+// ------------------------------------------------------------
+
+// Write data to the file at path such that, even if the process dies part way
+// through, the file will afterwards either have its old contents or all of
+// its new contents, never something in between.
+func writeFileAtomically(path string, data []byte) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Chmod(stdext.OwnerWritableReg); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadStateRedownloadsMissingEpisodes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, dir := range []string{dataSubdirMetadata, dataSubdirEpisodes} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pod := &podcast{ShortName: "example"}
+	w := newTestWatcher(pod)
+	present := ytVidInfo{id: "aaaaaaaaaaa", published: time.Now(), title: "Present"}
+	deleted := ytVidInfo{id: "bbbbbbbbbbb", published: time.Now(), title: "Deleted"}
+	w.vids = []ytVidInfo{present, deleted}
+	if err := w.saveState(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(present.episodePath(w.fileExtension()), []byte("episode"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w = newTestWatcher(pod)
+	if err := w.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.vids) != 2 {
+		t.Fatalf("restored %d vids, want 2", len(w.vids))
+	}
+	if _, ok := w.problemVids[present.id]; ok {
+		t.Errorf("vid whose episode file is present will be downloaded again")
+	}
+	pv, ok := w.problemVids[deleted.id]
+	if !ok || !pv.due() {
+		t.Errorf("vid whose episode file is missing won't be downloaded again straight away")
+	}
+}
+
+func TestStateKeepsPlaylistPositions(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir(dataSubdirMetadata, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	pod := &podcast{ShortName: "example", YTPlaylist: "PLexample", PlaylistOrder: playlistOrderPlaylist}
+	w := newTestWatcher(pod)
+	w.vids = []ytVidInfo{{id: "aaaaaaaaaaa"}, {id: "bbbbbbbbbbb"}, {id: "ccccccccccc"}}
+	w.playlistPositions = map[string]int64{"aaaaaaaaaaa": 2, "bbbbbbbbbbb": 0, "ccccccccccc": 1}
+	if err := w.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newTestWatcher(pod)
+	if err := restored.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(restored.playlistPositions, w.playlistPositions) {
+		t.Errorf("restored positions %v, want %v", restored.playlistPositions, w.playlistPositions)
+	}
+	// Vids that aren't of interest don't count as the playlist being
+	// reordered.
+	fetched := maps.Clone(w.playlistPositions)
+	fetched["ddddddddddd"] = 3
+	if restored.knownVidsRepositioned(fetched) {
+		t.Errorf("playlist considered reordered when only a vid not of interest was added")
+	}
+	fetched["aaaaaaaaaaa"], fetched["ccccccccccc"] = 1, 2
+	if !restored.knownVidsRepositioned(fetched) {
+		t.Errorf("playlist not considered reordered")
+	}
+}
+
+func TestStateSavedDuringCheckDoesntSkipItsVids(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, dir := range []string{dataSubdirMetadata, dataSubdirEpisodes} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pod := &podcast{
+		ShortName:  "example",
+		YTChannels: []channelSource{{YTChannelID: "UCabcdefghijklmnopqrstuv"}},
+	}
+	w := newTestWatcher(pod)
+	w.ctx = ctx
+	w.sched = newDownloadScheduler(ctx, 0, 0)
+	previousCheck := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w.lastChecked = previousCheck
+	if err := w.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkTime := previousCheck.Add(time.Hour)
+	latestVids := []ytVidInfo{{id: "aaaaaaaaaaa", published: checkTime.Add(-time.Minute)}}
+	// A download finishing before the check's vids are processed saves state.
+	if err := w.saveState(); err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestWatcher(pod)
+	if err := restored.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if !restored.lastChecked.Equal(previousCheck) {
+		t.Errorf("state saved during check has last check %v, want %v", restored.lastChecked, previousCheck)
+	}
+
+	w.processLatest(latestVids, checkTime)
+	restored = newTestWatcher(pod)
+	if err := restored.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if !restored.lastChecked.Equal(checkTime) || !restored.isKnownVid("aaaaaaaaaaa") {
+		t.Errorf("state saved after check has last check %v and vids %v", restored.lastChecked, restored.vids)
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Statistics are kept of the requests made for each feed and episode file,
+// broken down by which podcast client made them. For episodes, requests are
+// also counted as "downloads" following the IAB Podcast Measurement
+// Guidelines: the requests from the same IP address and user agent for the
+// same file within 24 hours count as at most one download, and only once
+// enough of the file has been served (so that, e.g., byte-range probes of the
+// first couple of bytes don't count). Known bots' requests are never
+// downloads.
+//
+// REF: https://iabtechlab.com/standards/podcast-measurement-guidelines/
+//
+// The statistics are saved in the data directory periodically and at
+// shutdown, are available as JSON at /stats, and can be printed by running
+// with the -stats flag.
+
+const (
+	httpStatsPath = "/stats"
+
+	statsSavePeriod     = 5 * time.Minute
+	statsDownloadWindow = 24 * time.Hour
+	// Roughly a minute of audio. Smaller files must be served in full.
+	statsDownloadMinBytes = 1 << 20
+)
+
+//nolint:gochecknoglobals
+var statsPath = filepath.Join(dataSubdirMetadata, "stats.json")
+
+// Families of podcast clients, identified by substrings of their User-Agent
+// headers (compared case-insensitively). The first family that matches wins.
+//
+//nolint:gochecknoglobals
+var statsClientFamilies = []struct {
+	name       string
+	substrings []string
+}{
+	{"Overcast", []string{"overcast"}},
+	{"Pocket Casts", []string{"pocketcasts", "pocket casts"}},
+	{"Castro", []string{"castro"}},
+	{"Spotify", []string{"spotify"}},
+	{"AntennaPod", []string{"antennapod"}},
+	{"Podcast Addict", []string{"podcastaddict", "podcast addict"}},
+	{"Apple Podcasts", []string{"applecoremedia", "apple podcasts", "itms", "podcasts/"}},
+	{statsClientBots, []string{"bot", "crawler", "spider", "curl/", "wget/", "python-", "go-http-client"}},
+	{"Browsers", []string{"mozilla/"}},
+}
+
+const (
+	statsClientBots  = "Bots"
+	statsClientOther = "Other"
+)
+
+func statsClientFamily(userAgent string) string {
+	userAgent = strings.ToLower(userAgent)
+	for _, family := range statsClientFamilies {
+		for _, s := range family.substrings {
+			if strings.Contains(userAgent, s) {
+				return family.name
+			}
+		}
+	}
+	return statsClientOther
+}
+
+// ------------------------------------------------------------
+
+type fileStats struct {
+	// Short names of the podcasts the file belonged to when last requested.
+	Podcasts []string `json:"podcasts,omitempty"`
+	// Keyed by client family.
+	Requests  map[string]uint64 `json:"requests"`
+	Downloads map[string]uint64 `json:"downloads,omitempty"`
+}
+
+type statsData struct {
+	Since time.Time `json:"since"`
+	// Keyed by path relative to the data directory.
+	Feeds    map[string]*fileStats `json:"feeds"`
+	Episodes map[string]*fileStats `json:"episodes"`
+}
+
+type statsDownloadKey struct {
+	addr, userAgent, relPath string
+}
+
+type statsPendingDownload struct {
+	windowStart time.Time
+	bytes       uint64
+	counted     bool
+}
+
+type statsRecorder struct {
+	// Whether requests come via a reverse proxy (i.e. link_proxy is set), in
+	// which case the client's address is the one the proxy appended to the
+	// X-Forwarded-For header.
+	behindProxy bool
+
+	mu      sync.Mutex
+	data    statsData
+	dirty   bool
+	pending map[statsDownloadKey]*statsPendingDownload
+}
+
+//nolint:gochecknoglobals
+var stats = &statsRecorder{
+	data:    newStatsData(),
+	pending: make(map[statsDownloadKey]*statsPendingDownload),
+}
+
+func newStatsData() statsData {
+	return statsData{
+		Since:    time.Now(),
+		Feeds:    make(map[string]*fileStats),
+		Episodes: make(map[string]*fileStats),
+	}
+}
+
+// Record that r, a request for the file at relPath, was responded to with
+// status after n bytes of the file were served.
+func (sr *statsRecorder) record(r *http.Request, relPath string, status int, n uint64) {
+	if status >= http.StatusBadRequest || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return
+	}
+	dir := path.Dir(relPath)
+	isEpisode := dir == dataSubdirEpisodes
+	isFeed := dir == dataSubdirMetadata && path.Ext(relPath) == ".xml"
+	if !isEpisode && !isFeed {
+		return
+	}
+	family := statsClientFamily(r.UserAgent())
+	owners := podcastAccessControl.owners(relPath)
+	slices.Sort(owners)
+
+	var size int64
+	if isEpisode && family != statsClientBots {
+		if info, err := os.Stat(relPath); err == nil {
+			size = info.Size()
+		}
+	}
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	files := sr.data.Feeds
+	if isEpisode {
+		files = sr.data.Episodes
+	}
+	fst, ok := files[relPath]
+	if !ok {
+		fst = &fileStats{Requests: make(map[string]uint64)}
+		files[relPath] = fst
+	}
+	if len(owners) > 0 {
+		fst.Podcasts = owners
+	}
+	fst.Requests[family]++
+	sr.dirty = true
+
+	if size == 0 || n == 0 {
+		return
+	}
+	now := time.Now()
+	key := statsDownloadKey{addr: sr.clientAddr(r), userAgent: r.UserAgent(), relPath: relPath}
+	pd, ok := sr.pending[key]
+	if !ok || now.Sub(pd.windowStart) >= statsDownloadWindow {
+		pd = &statsPendingDownload{windowStart: now}
+		sr.pending[key] = pd
+	}
+	pd.bytes += n
+	if !pd.counted && pd.bytes >= min(statsDownloadMinBytes, uint64(size)) {
+		pd.counted = true
+		if fst.Downloads == nil {
+			fst.Downloads = make(map[string]uint64)
+		}
+		fst.Downloads[family]++
+	}
+}
+
+func (sr *statsRecorder) clientAddr(r *http.Request) string {
+	if sr.behindProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(fwd[len(fwd)-1], ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Load previously saved statistics, if there are any.
+func (sr *statsRecorder) load() error {
+	buf, err := os.ReadFile(statsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := parseStatsData(buf)
+	if err != nil {
+		return fmt.Errorf("%s: %w", statsPath, err)
+	}
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.data = data
+	return nil
+}
+
+func parseStatsData(buf []byte) (statsData, error) {
+	data := newStatsData()
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return statsData{}, err
+	}
+	if data.Feeds == nil {
+		data.Feeds = make(map[string]*fileStats)
+	}
+	if data.Episodes == nil {
+		data.Episodes = make(map[string]*fileStats)
+	}
+	return data, nil
+}
+
+// Save the statistics if they have changed since they were last saved.
+func (sr *statsRecorder) save() error {
+	sr.mu.Lock()
+	if !sr.dirty {
+		sr.mu.Unlock()
+		return nil
+	}
+	buf, err := json.MarshalIndent(sr.data, "", "\t")
+	sr.dirty = false
+	sr.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomically(statsPath, buf); err != nil {
+		sr.mu.Lock()
+		sr.dirty = true
+		sr.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Periodically save the statistics, and forget about downloads whose window
+// for deduplication has passed.
+func (sr *statsRecorder) runLoop() {
+	ticker := time.NewTicker(statsSavePeriod)
+	for range ticker.C {
+		if err := sr.save(); err != nil {
+			log.Printf("Saving stats failed: %v", err)
+		}
+		sr.mu.Lock()
+		for key, pd := range sr.pending {
+			if time.Since(pd.windowStart) >= statsDownloadWindow {
+				delete(sr.pending, key)
+			}
+		}
+		sr.mu.Unlock()
+	}
+}
+
+// Serves the statistics as JSON, optionally only those for the podcast named
+// by the podcast query parameter. Those of private podcasts are only included
+// if the request carries one of their tokens.
+func (sr *statsRecorder) handler(w http.ResponseWriter, r *http.Request) {
+	shortName := r.URL.Query().Get("podcast")
+	mayReport := podcastAccessControl.reportFilter(r)
+	sr.mu.Lock()
+	buf, err := json.Marshal(sr.data)
+	sr.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Marshalling then unmarshalling makes a deep copy to filter without
+	// holding the lock.
+	data, err := parseStatsData(buf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, files := range []map[string]*fileStats{data.Feeds, data.Episodes} {
+		for relPath, fst := range files {
+			fst.Podcasts = slices.DeleteFunc(fst.Podcasts, func(name string) bool {
+				return !mayReport(name)
+			})
+			if len(fst.Podcasts) == 0 || (shortName != "" && !slices.Contains(fst.Podcasts, shortName)) {
+				delete(files, relPath)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(data); err != nil {
+		log.Printf("stats: %v", err)
+	}
+}
+
+// ------------------------------------------------------------
+
+// Print a human-readable report of the statistics saved at statsFilePath.
+func printStatsReport(w io.Writer, statsFilePath string) error {
+	buf, err := os.ReadFile(statsFilePath)
+	if err != nil {
+		return err
+	}
+	data, err := parseStatsData(buf)
+	if err != nil {
+		return fmt.Errorf("%s: %w", statsFilePath, err)
+	}
+
+	// Group the files by podcast.
+	type podcastFiles struct{ feeds, episodes []string }
+	byPodcast := make(map[string]*podcastFiles)
+	group := func(files map[string]*fileStats, isEpisode bool) {
+		for relPath, fst := range files {
+			owners := fst.Podcasts
+			if len(owners) == 0 {
+				owners = []string{"(unknown)"}
+			}
+			for _, shortName := range owners {
+				pf, ok := byPodcast[shortName]
+				if !ok {
+					pf = new(podcastFiles)
+					byPodcast[shortName] = pf
+				}
+				if isEpisode {
+					pf.episodes = append(pf.episodes, relPath)
+				} else {
+					pf.feeds = append(pf.feeds, relPath)
+				}
+			}
+		}
+	}
+	group(data.Feeds, false)
+	group(data.Episodes, true)
+	shortNames := make([]string, 0, len(byPodcast))
+	for shortName := range byPodcast {
+		shortNames = append(shortNames, shortName)
+	}
+	slices.Sort(shortNames)
+
+	fmt.Fprintf(w, "Statistics since %s\n", data.Since.Format(time.RFC1123))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, shortName := range shortNames {
+		pf := byPodcast[shortName]
+		fmt.Fprintf(tw, "\nPodcast %s\n", shortName)
+		slices.Sort(pf.feeds)
+		for _, relPath := range pf.feeds {
+			fst := data.Feeds[relPath]
+			fmt.Fprintf(tw, "  Requests for %s: %d (%s)\n",
+				relPath, sumStatsCounts(fst.Requests), formatStatsCounts(fst.Requests))
+		}
+		if len(pf.episodes) == 0 {
+			continue
+		}
+		// Most downloaded first.
+		slices.SortFunc(pf.episodes, func(a, b string) int {
+			da, db := sumStatsCounts(data.Episodes[a].Downloads), sumStatsCounts(data.Episodes[b].Downloads)
+			return cmp.Or(cmp.Compare(db, da), strings.Compare(a, b))
+		})
+		fmt.Fprintln(tw, "  EPISODE\tDOWNLOADS\tREQUESTS\tDOWNLOADS BY CLIENT")
+		for _, relPath := range pf.episodes {
+			fst := data.Episodes[relPath]
+			fmt.Fprintf(tw, "  %s\t%d\t%d\t%s\n", relPath,
+				sumStatsCounts(fst.Downloads), sumStatsCounts(fst.Requests), formatStatsCounts(fst.Downloads))
+		}
+	}
+	return tw.Flush()
+}
+
+func sumStatsCounts(counts map[string]uint64) uint64 {
+	var sum uint64
+	for _, n := range counts {
+		sum += n
+	}
+	return sum
+}
+
+// Formats counts keyed by client family, largest first.
+func formatStatsCounts(counts map[string]uint64) string {
+	families := make([]string, 0, len(counts))
+	for family := range counts {
+		families = append(families, family)
+	}
+	slices.SortFunc(families, func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), strings.Compare(a, b))
+	})
+	parts := make([]string, len(families))
+	for i, family := range families {
+		parts[i] = fmt.Sprintf("%s %d", family, counts[family])
+	}
+	return strings.Join(parts, ", ")
+}
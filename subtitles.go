@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A podcast can have its episodes' YouTube captions fetched too, in the first
+// of its configured languages that has any. A vid's own captions are preferred
+// over YouTube's automatically generated ones. They are converted to WebVTT,
+// SubRip and plain text transcript companion files, which the feed links to.
+//
+// They're fetched when an episode is downloaded, and after each check for
+// episodes that don't have them yet (e.g. because they were downloaded before
+// subtitles were configured, or YouTube hadn't generated captions yet), a few
+// at a time and no more than once a day per episode.
+
+const (
+	subtitlesInfix = ".subs"
+	// Limits how long fetching missing subtitles holds up checks.
+	subtitlesBackfillBatch = 10
+	subtitlesRetryInterval = 24 * time.Hour
+	// After this many tries, an episode's subtitles are only tried for again
+	// after a restart.
+	subtitlesMaxAttempts = 7
+	// A gap at least this long between captions starts a new paragraph in a
+	// plain text transcript.
+	transcriptParagraphGap = 2 * time.Second
+)
+
+// Fetch vi's captions and write its transcript companion files. Returns
+// the language of the captions, or an empty string if there were none in any
+// of langs.
+func (w *watcher) fetchSubtitles(ctx context.Context, vi ytVidInfo, langs []string) (string, error) {
+	// The downloader's output has the same prefix as a partial episode, so
+	// that it's cleaned up the same way if anything goes wrong. The rest of
+	// the prefix is unique, because an episode's subtitles might be fetched
+	// after its download while also being fetched by the backfill.
+	placeholder, err := os.CreateTemp(dataSubdirEpisodes, vi.id+partialEpisodeInfix+subtitlesInfix+"*")
+	if err != nil {
+		return "", err
+	}
+	placeholder.Close()
+	prefix := placeholder.Name()
+	defer func() {
+		matches, _ := filepath.Glob(prefix + "*")
+		for _, path := range matches {
+			os.Remove(path)
+		}
+	}()
+
+	var errBuf bytes.Buffer
+	cmd := exec.CommandContext(ctx, w.cfg.DownloaderName,
+		"--skip-download",
+		"--write-subs", "--write-auto-subs",
+		"--sub-langs", strings.Join(langs, ","),
+		"--sub-format", "vtt",
+		"--socket-timeout", "30",
+		"-o", prefix+".%(ext)s",
+		"--", vi.id)
+	cmd.Stderr = &errBuf
+	cmd.WaitDelay = downloaderWaitDelay
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, lastLine(errBuf.String()))
+	}
+
+	for _, lang := range langs {
+		buf, err := os.ReadFile(fmt.Sprint(prefix, ".", lang, ".vtt"))
+		if err != nil {
+			continue
+		}
+		cues, err := parseVTT(string(buf))
+		if err != nil {
+			return "", fmt.Errorf("%s captions: %w", lang, err)
+		}
+		for _, f := range []struct {
+			ext    string
+			format func([]caption) string
+		}{
+			{"vtt", formatVTT},
+			{"srt", formatSRT},
+			{"txt", formatTranscript},
+		} {
+			if err := writeFileAtomically(vi.transcriptPath(lang, f.ext), []byte(f.format(cues))); err != nil {
+				return "", err
+			}
+		}
+		return lang, nil
+	}
+	return "", nil
+}
+
+type subtitlesAttempts struct {
+	count int
+	last  time.Time
+}
+
+// Fetch the subtitles of some of the known vids that have been downloaded but
+// have no transcripts. Only the watch goroutine calls this.
+func (w *watcher) fetchMissingSubtitles() {
+	langs := w.pod.SubtitleLangs
+	if len(langs) == 0 {
+		return
+	}
+	companions, err := readCompanionFiles()
+	if err != nil {
+		log.Printf("%s: Looking for episodes' companion files failed: %v", w.pod, err)
+		return
+	}
+
+	var fetched, tried int
+	for i := range w.vids {
+		if tried == subtitlesBackfillBatch || w.ctx.Err() != nil {
+			break
+		}
+		vi := &w.vids[i]
+		if slices.ContainsFunc(companions[vi.id], func(cf companionFile) bool { return !cf.isChapters() }) {
+			continue
+		}
+		if _, err := os.Stat(vi.episodePath(w.fileExtension())); err != nil {
+			continue
+		}
+		attempts := w.subtitlesAttempts[vi.id]
+		if attempts.count >= subtitlesMaxAttempts || time.Since(attempts.last) < subtitlesRetryInterval {
+			continue
+		}
+		w.subtitlesAttempts[vi.id] = subtitlesAttempts{count: attempts.count + 1, last: time.Now()}
+		tried++
+
+		lang, err := w.fetchSubtitles(w.ctx, *vi, langs)
+		switch {
+		case err != nil:
+			log.Printf("%s: Fetching subtitles of %s failed: %v", w.pod, vi.id, err)
+		case lang != "":
+			fetched++
+		}
+	}
+	if fetched > 0 {
+		log.Printf("%s: Fetched missing subtitles of %d episodes", w.pod, fetched)
+		w.mu.Lock()
+		w.feedOutdated = true
+		w.mu.Unlock()
+	}
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return s[strings.LastIndex(s, "\n")+1:]
+}
+
+// ------------------------------------------------------------
+
+type caption struct {
+	start, end time.Duration
+	lines      []string
+}
+
+//nolint:gochecknoglobals
+var (
+	vttTimingLine = regexp.MustCompile(`^((?:\d+:)?\d{2}:\d{2}\.\d{3})\s+-->\s+((?:\d+:)?\d{2}:\d{2}\.\d{3})`)
+	vttTag        = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Parse WebVTT captions, removing their markup. YouTube's automatically
+// generated captions repeat each line in the following caption (so that it
+// scrolls up), so lines that repeat the previous caption's last line are
+// dropped, along with captions left with no lines.
+func parseVTT(vtt string) ([]caption, error) {
+	vtt = strings.ReplaceAll(vtt, "\r\n", "\n")
+	if !strings.HasPrefix(strings.TrimPrefix(vtt, "\ufeff"), "WEBVTT") {
+		return nil, errors.New("not WebVTT")
+	}
+	var (
+		captions []caption
+		prevLine string
+	)
+	for _, block := range strings.Split(vtt, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		// The timing line may be preceded by the cue's identifier.
+		i := 0
+		for i < len(lines) && !strings.Contains(lines[i], "-->") {
+			i++
+		}
+		if i == len(lines) {
+			// The header, a comment, a style, or some such.
+			continue
+		}
+		m := vttTimingLine.FindStringSubmatch(lines[i])
+		if m == nil {
+			return nil, fmt.Errorf("malformed timing %q", lines[i])
+		}
+		c := caption{start: parseVTTTimestamp(m[1]), end: parseVTTTimestamp(m[2])}
+		for _, line := range lines[i+1:] {
+			line = strings.TrimSpace(html.UnescapeString(vttTag.ReplaceAllString(line, "")))
+			if line == "" || line == prevLine {
+				continue
+			}
+			c.lines = append(c.lines, line)
+			prevLine = line
+		}
+		if len(c.lines) > 0 {
+			captions = append(captions, c)
+		}
+	}
+	return captions, nil
+}
+
+// e.g. "01:02:03.456" or "02:03.456"
+func parseVTTTimestamp(s string) time.Duration {
+	secs, frac, _ := strings.Cut(s, ".")
+	var d time.Duration
+	for _, part := range strings.Split(secs, ":") {
+		// The timing line's format has already been checked.
+		n, _ := strconv.Atoi(part)
+		d = d*60 + time.Duration(n)*time.Second
+	}
+	ms, _ := strconv.Atoi(frac)
+	return d + time.Duration(ms)*time.Millisecond
+}
+
+func formatCaptionTimestamp(d time.Duration, fracSep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, fracSep, ms%1000)
+}
+
+func formatVTT(captions []caption) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for _, c := range captions {
+		fmt.Fprintf(&b, "\n%s --> %s\n%s\n",
+			formatCaptionTimestamp(c.start, "."), formatCaptionTimestamp(c.end, "."), strings.Join(c.lines, "\n"))
+	}
+	return b.String()
+}
+
+func formatSRT(captions []caption) string {
+	var b strings.Builder
+	for i, c := range captions {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n", i+1,
+			formatCaptionTimestamp(c.start, ","), formatCaptionTimestamp(c.end, ","), strings.Join(c.lines, "\n"))
+	}
+	return b.String()
+}
+
+// The captions' text as paragraphs, split where there are pauses.
+func formatTranscript(captions []caption) string {
+	var b strings.Builder
+	for i, c := range captions {
+		switch {
+		case i == 0:
+		case c.start-captions[i-1].end >= transcriptParagraphGap:
+			b.WriteString("\n\n")
+		default:
+			b.WriteString(" ")
+		}
+		b.WriteString(strings.Join(c.lines, " "))
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
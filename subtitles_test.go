@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Like YouTube's automatically generated captions, in which each line is
+// repeated in the following caption so that it scrolls up.
+const autoCaptionsVTT = "\ufeffWEBVTT\r\nKind: captions\r\nLanguage: en\r\n\r\n" +
+	"00:00:00.000 --> 00:00:02.000 align:start position:0%\r\n" +
+	"hello<00:00:01.000><c> world</c>\r\n\r\n" +
+	"00:00:02.000 --> 00:00:02.010 align:start position:0%\r\n" +
+	"hello world\r\n \r\n\r\n" +
+	"00:00:02.010 --> 00:00:04.000 align:start position:0%\r\n" +
+	"hello world\r\n" +
+	"how &amp; are you\r\n\r\n" +
+	"1\r\n" +
+	"01:00:08.000 --> 01:00:09.500\r\n" +
+	"bye\r\n"
+
+func TestParseVTT(t *testing.T) {
+	got, err := parseVTT(autoCaptionsVTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []caption{
+		{0, 2 * time.Second, []string{"hello world"}},
+		{2010 * time.Millisecond, 4 * time.Second, []string{"how & are you"}},
+		{time.Hour + 8*time.Second, time.Hour + 9500*time.Millisecond, []string{"bye"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{"", "1\n00:00:00,000 --> 00:00:01,000\nSRT\n", "WEBVTT\n\n00:00 --> 00:01\nbad timing\n"} {
+		if _, err := parseVTT(bad); err == nil {
+			t.Errorf("no error parsing %q", bad)
+		}
+	}
+}
+
+func TestFormatCaptions(t *testing.T) {
+	captions := []caption{
+		{0, 2 * time.Second, []string{"hello world"}},
+		{2010 * time.Millisecond, 4 * time.Second, []string{"how are", "you"}},
+		{time.Hour + 8*time.Second, time.Hour + 9500*time.Millisecond, []string{"bye"}},
+	}
+	for _, tc := range []struct {
+		name   string
+		format func([]caption) string
+		want   string
+	}{
+		{"vtt", formatVTT, "WEBVTT\n" +
+			"\n00:00:00.000 --> 00:00:02.000\nhello world\n" +
+			"\n00:00:02.010 --> 00:00:04.000\nhow are\nyou\n" +
+			"\n01:00:08.000 --> 01:00:09.500\nbye\n"},
+		{"srt", formatSRT, "1\n00:00:00,000 --> 00:00:02,000\nhello world\n" +
+			"\n2\n00:00:02,010 --> 00:00:04,000\nhow are\nyou\n" +
+			"\n3\n01:00:08,000 --> 01:00:09,500\nbye\n"},
+		// A new paragraph starts after a long enough gap.
+		{"txt", formatTranscript, "hello world how are you\n\nbye\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.format(captions); got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+	if got := formatTranscript(nil); got != "" {
+		t.Errorf("transcript of no captions = %q", got)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// The built-in webserver can serve HTTPS, using either a certificate & key
+// pair from disk, or a certificate that is automatically obtained (and
+// renewed) from Let's Encrypt using ACME.
+
+const httpsDefaultPort = 443
+
+func (c *config) tlsEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSACME
+}
+
+// Configure websrv to serve HTTPS as specified by cfg. If cfg specifies an
+// HTTP port to redirect from, a server for that is returned too.
+func configureTLS(websrv *http.Server, cfg *config) (redirectsrv *http.Server, err error) {
+	var acmeMgr *autocert.Manager
+	if cfg.TLSACME {
+		acmeMgr = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cfg.TLSACMECacheDir),
+			HostPolicy: autocert.HostWhitelist(cfg.ServeHost),
+			Email:      cfg.TLSACMEEmail,
+		}
+		websrv.TLSConfig = acmeMgr.TLSConfig()
+		log.Printf("Using ACME to obtain a TLS certificate for %s", cfg.ServeHost)
+	} else {
+		certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		websrv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.getCertificate,
+		}
+	}
+
+	if cfg.HTTPRedirectPort == 0 {
+		return nil, nil
+	}
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, buildServeURL(cfg, strings.TrimPrefix(r.URL.RequestURI(), "/")),
+			http.StatusMovedPermanently)
+	})
+	if acmeMgr != nil {
+		// Also answer ACME HTTP-01 challenges.
+		handler = acmeMgr.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:        fmt.Sprint(cfg.ServeHost, ":", cfg.HTTPRedirectPort),
+		Handler:     handler,
+		ReadTimeout: websrvClientReadTimout,
+	}, nil
+}
+
+// Returns the URL that the built-in webserver serves the file at filePath at.
+func buildServeURL(cfg *config, filePath string) string {
+	scheme, defaultPort := "http", 80
+	if cfg.tlsEnabled() {
+		scheme, defaultPort = "https", httpsDefaultPort
+	}
+	var portPart string
+	if cfg.ServePort != defaultPort {
+		portPart = fmt.Sprintf(":%d", cfg.ServePort)
+	}
+	return fmt.Sprintf("%s://%s%s/%s", scheme, cfg.ServeHost, portPart, filePath)
+}
+
+// ------------------------------------------------------------
+
+// Loads a certificate & key pair from disk, and loads it again whenever either
+// file is modified (e.g. when the certificate is renewed by certbot).
+type certReloader struct {
+	certPath, keyPath string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	loadedMod time.Time
+}
+
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	cr := certReloader{certPath: certPath, keyPath: keyPath}
+	if _, err := cr.getCertificate(nil); err != nil {
+		return nil, err
+	}
+	return &cr, nil
+}
+
+func (cr *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	var latestMod time.Time
+	for _, path := range []string{cr.certPath, cr.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			if cr.cert != nil {
+				// Keep using what was loaded before.
+				return cr.cert, nil
+			}
+			return nil, err
+		}
+		if info.ModTime().After(latestMod) {
+			latestMod = info.ModTime()
+		}
+	}
+	if cr.cert != nil && !latestMod.After(cr.loadedMod) {
+		return cr.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certPath, cr.keyPath)
+	if err != nil {
+		if cr.cert != nil {
+			// The files might be in the middle of being replaced.
+			log.Printf("Reloading TLS certificate failed: %v", err)
+			return cr.cert, nil
+		}
+		return nil, errors.New("loading TLS certificate: " + err.Error())
+	}
+	if cr.cert != nil {
+		log.Print("Reloaded TLS certificate from ", cr.certPath)
+	}
+	cr.cert, cr.loadedMod = &cert, latestMod
+	return cr.cert, nil
+}
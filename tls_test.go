@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildServeURL(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  config
+		want string
+	}{
+		{config{ServeHost: "example.com", ServePort: 80}, "http://example.com/meta/x.xml"},
+		{config{ServeHost: "example.com", ServePort: 8080}, "http://example.com:8080/meta/x.xml"},
+		{config{ServeHost: "example.com", ServePort: 443}, "http://example.com:443/meta/x.xml"},
+		{config{ServeHost: "example.com", ServePort: 443, TLSACME: true}, "https://example.com/meta/x.xml"},
+		{config{ServeHost: "example.com", ServePort: 80, TLSCertFile: "cert.pem"}, "https://example.com:80/meta/x.xml"},
+		{config{ServeHost: "example.com", ServePort: 8443, TLSCertFile: "cert.pem"}, "https://example.com:8443/meta/x.xml"},
+	} {
+		if got := buildServeURL(&tc.cfg, "meta/x.xml"); got != tc.want {
+			t.Errorf("URL with %+v = %q, want %q", tc.cfg, got, tc.want)
+		}
+	}
+}
+
+// Write a self-signed certificate & key pair for commonName to dir, returning
+// their paths.
+func writeTestCert(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for path, block := range map[string]*pem.Block{
+		certPath: {Type: "CERTIFICATE", Bytes: der},
+		keyPath:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certPath, keyPath
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCert(t, dir, "first")
+	cr, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commonName := func() string {
+		cert, err := cr.getCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Subject.CommonName
+	}
+
+	// Renewed.
+	writeTestCert(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{certPath, keyPath} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := commonName(); got != "second" {
+		t.Errorf("after renewal, serving certificate for %q", got)
+	}
+
+	// In the middle of being replaced.
+	if err := os.WriteFile(certPath, []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	evenLater := later.Add(time.Minute)
+	if err := os.Chtimes(certPath, evenLater, evenLater); err != nil {
+		t.Fatal(err)
+	}
+	if got := commonName(); got != "second" {
+		t.Errorf("while being replaced, serving certificate for %q", got)
+	}
+
+	if _, err := newCertReloader(filepath.Join(dir, "missing.pem"), keyPath); err == nil {
+		t.Error("no error for missing certificate")
+	}
+}
+
+func TestConfigureTLSRedirect(t *testing.T) {
+	certPath, keyPath := writeTestCert(t, t.TempDir(), "example.com")
+	cfg := &config{
+		ServeHost:        "example.com",
+		ServePort:        443,
+		TLSCertFile:      certPath,
+		TLSKeyFile:       keyPath,
+		HTTPRedirectPort: 80,
+	}
+	websrv := &http.Server{}
+	redirectsrv, err := configureTLS(websrv, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if websrv.TLSConfig == nil || redirectsrv == nil {
+		t.Fatalf("TLS config %v, redirect server %v", websrv.TLSConfig, redirectsrv)
+	}
+	rec := httptest.NewRecorder()
+	redirectsrv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/meta/x.xml?token=abc", nil))
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusMovedPermanently || loc != "https://example.com/meta/x.xml?token=abc" {
+		t.Errorf("redirected with %d to %q", rec.Code, loc)
+	}
+
+	cfg.HTTPRedirectPort = 0
+	if redirectsrv, err := configureTLS(&http.Server{}, cfg); err != nil || redirectsrv != nil {
+		t.Errorf("without redirect port, got redirect server %v and error %v", redirectsrv, err)
+	}
+}
@@ -12,6 +12,7 @@ type ytVidInfo struct {
 	published time.Time
 	title     string
 	desc      string
+	vidDetails
 }
 
 func makeYtVidInfo(id string, published time.Time, title, desc string) ytVidInfo {
@@ -42,3 +43,29 @@ func (v vidsChronoSorter) Swap(i, j int) {
 func (v vidsChronoSorter) Less(i, j int) bool {
 	return v[i].published.Before(v[j].published)
 }
+
+// ------------------------------------------------------------
+
+// Sort vids by their position in a playlist. Those with no known position are
+// sorted to the end.
+type vidsPlaylistSorter struct {
+	vids      []ytVidInfo
+	positions map[string]int64
+}
+
+func (v vidsPlaylistSorter) Len() int {
+	return len(v.vids)
+}
+
+func (v vidsPlaylistSorter) Swap(i, j int) {
+	v.vids[i], v.vids[j] = v.vids[j], v.vids[i]
+}
+
+func (v vidsPlaylistSorter) Less(i, j int) bool {
+	pi, iok := v.positions[v.vids[i].id]
+	pj, jok := v.positions[v.vids[j].id]
+	if iok && jok {
+		return pi < pj
+	}
+	return iok && !jok
+}
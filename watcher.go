@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
@@ -9,17 +11,20 @@ import (
 	"image"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/jbub/podcasts"
 	"github.com/snapas/resize"
+	"github.com/zyedidia/generic/mapset"
 	"google.golang.org/api/youtube/v3"
 
 	"github.com/frou/stdext"
@@ -33,20 +38,53 @@ type watcher struct {
 	cfg           *config
 	pod           *podcast
 	checkInterval time.Duration
+	sched         *downloadScheduler
+
+	// Cancelled when the watcher is stopped.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Receives updated config for the podcast when the config file is
+	// reloaded.
+	reconfigc chan *podcast
 
 	initialCheck bool
-	lastChecked  time.Time
 	ytAPIRespite time.Duration
-	vids         []ytVidInfo
-
-	problemVids map[string]ytVidInfo
+	// Keyed by vid ID.
+	subtitlesAttempts map[string]subtitlesAttempts
+	// The image that the podcast's artwork is based on when there's no custom
+	// image.
+	thumbURL string
+
+	// Guards the fields below, which the scheduler's download workers also
+	// make use of. Only the watch goroutine modifies vids, so it alone can read
+	// that without holding the lock.
+	mu          sync.Mutex
+	lastChecked time.Time
+	vids        []ytVidInfo
+
+	// Only used for podcasts based on a playlist.
+	playlistPositions map[string]int64
+	// The URL-based GUIDs of episodes published by older versions, keyed by
+	// vid ID.
+	legacyGUIDs map[string]string
+	// Whether the feed needs writing regardless of there being new vids.
+	feedOutdated bool
+	// Once stopped, the watcher doesn't write anything to disk.
+	stopped bool
+
+	// Vids that have been queued for their first download attempt, but whose
+	// outcome isn't known yet.
+	pendingVids mapset.Set[string]
+	problemVids map[string]*problemVid
 	cleanc      chan *cleaningWhitelist
 }
 
 func newWatcher(
+	ctx context.Context,
 	ytAPI *youtube.Service,
 	cfg *config,
 	pod *podcast,
+	sched *downloadScheduler,
 	cleanc chan *cleaningWhitelist) (*watcher, error,
 ) {
 	w := watcher{
@@ -54,105 +92,180 @@ func newWatcher(
 		cfg:           cfg,
 		pod:           pod,
 		checkInterval: time.Duration(cfg.CheckIntervalMinutes) * time.Minute,
-
-		initialCheck: true,
-		problemVids:  make(map[string]ytVidInfo),
-		cleanc:       cleanc,
+		sched:         sched,
+		reconfigc:     make(chan *podcast, 1),
+
+		initialCheck:      true,
+		subtitlesAttempts: make(map[string]subtitlesAttempts),
+		pendingVids:       mapset.New[string](),
+		problemVids:       make(map[string]*problemVid),
+		legacyGUIDs:       make(map[string]string),
+		cleanc:            cleanc,
 	}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	sched.setCap(&w, pod.MaxConcurrentDownloads)
+	podcastAccessControl.setPodcast(pod)
+	podcastHealths.setPodcast(pod)
+
+	// Pick up where things were left off before the last restart, if possible.
+	if err := w.loadState(); err != nil {
+		log.Printf("%s: Loading state failed, so starting afresh: %v", w.pod, err)
+		w.vids = nil
+		w.problemVids = make(map[string]*problemVid)
+		w.legacyGUIDs = make(map[string]string)
+		w.lastChecked = time.Time{}
+	}
+	w.adoptLegacyGUIDsAndSave()
 
 	// Up front, check that the YouTube API is working. Do this by fetching the
-	// name of the channel and its 'avatar' image (both made use of later).
-	err := w.getChannelInfo()
+	// name of the channel (or playlist) and its image (both made use of later).
+	var err error
+	if w.pod.YTPlaylist != "" {
+		err = w.getPlaylistInfo()
+	} else {
+		err = w.getChannelsInfo()
+	}
 	return &w, err
 }
 
 func (w *watcher) watch() {
 	for {
-		// Sleep until it's time for a check.
+		// Sleep until it's time for a check. The initial check is done
+		// straight away, even if state restored from disk says that the last
+		// check was recent.
 		elapsed := time.Since(w.lastChecked)
-		if elapsed < w.checkInterval {
-			time.Sleep(w.checkInterval - elapsed)
+		if !w.initialCheck && elapsed < w.checkInterval {
+			if !w.sleep(w.checkInterval - elapsed) {
+				return
+			}
 		}
 
-		// The initial check does a full query for vids. Subsequent checks need
-		// only query vids published after the last check.
+		// The initial check does a full query for vids (unless state restored
+		// from disk already covers them). Subsequent checks need only query
+		// vids published after the last check.
 		var pubdAfter time.Time
-		if w.initialCheck {
+		if w.lastChecked.IsZero() {
 			pubdAfter = w.pod.Epoch
 			if !w.pod.Epoch.IsZero() {
 				log.Printf("%s: Epoch is configured as %s",
 					w.pod, w.pod.EpochStr)
 			}
-			// Write out the feed early. Even though it contains no items yet,
-			// it's better that the XML file exist in some form vs 404ing.
+		} else {
+			pubdAfter = w.lastChecked
+		}
+		if w.initialCheck {
+			// Write out the feed early. Even though it may contain no items
+			// yet, it's better that the XML file exist in some form vs 404ing.
+			w.mu.Lock()
 			if err := w.writeFeed(); err != nil {
 				log.Printf("%s: Writing feed failed: %v", w.pod, err)
 			}
-		} else {
-			pubdAfter = w.lastChecked
+			w.mu.Unlock()
 		}
 
 		// Do the check.
-		latestVids, err := w.getLatest(pubdAfter)
+		checkStart := time.Now()
+		latestVids, checkTime, err := w.getLatest(pubdAfter)
+		w.recordCheck(time.Since(checkStart), err)
 		if err != nil {
 			log.Printf("%s: Getting latest vids failed: %v", w.pod, err)
 			if w.ytAPIRespite > 0 {
 				log.Printf("%s: Giving YouTube API %v respite",
 					w.pod, w.ytAPIRespite)
-				time.Sleep(w.ytAPIRespite)
+				if !w.sleep(w.ytAPIRespite) {
+					return
+				}
 				w.ytAPIRespite = 0
 			}
 			continue
 		}
-
-		if *flagDataClean && w.initialCheck {
-			w.sendCleaningWhitelist(latestVids)
+		if w.ctx.Err() != nil {
+			return
+		}
+		w.fillVidDetails(latestVids)
+		if w.initialCheck {
+			w.writeMissingChaptersFiles()
+		}
+		w.fetchMissingSubtitles()
+
+		// Watchers started by a config reload have no cleaning channel,
+		// since the data directory is only cleaned when the daemon starts.
+		if *flagDataClean && w.initialCheck && w.cleanc != nil {
+			allVids := make([]ytVidInfo, 0, len(w.vids)+len(latestVids))
+			allVids = append(allVids, w.vids...)
+			allVids = append(allVids, latestVids...)
+			w.sendCleaningWhitelist(allVids)
 		}
 
-		w.processLatest(latestVids)
+		w.processLatest(latestVids, checkTime)
 		w.initialCheck = false
 	}
 }
 
-func (w *watcher) processLatest(latestVids []ytVidInfo) {
+// Sleep for d, or until the watcher is reconfigured. Returns false if the
+// watcher was stopped in the meantime.
+func (w *watcher) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-w.ctx.Done():
+		return false
+	case newPod := <-w.reconfigc:
+		w.reconfigure(newPod)
+	}
+	return true
+}
+
+// Stop the watcher. Downloads that it has queued are abandoned, and any that
+// are in-flight will have their outcomes disregarded.
+func (w *watcher) stop() {
+	w.cancel()
+	w.sched.forget(w)
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+}
+
+// Take on the vids found by a check that began at checkTime.
+func (w *watcher) processLatest(latestVids []ytVidInfo, checkTime time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+
+	// The check only counts as done once its vids are known, so that state
+	// saved in the meantime (e.g. as a download finishes) doesn't claim to
+	// cover vids that it doesn't contain.
 	w.vids = append(w.vids, latestVids...)
+	w.lastChecked = checkTime
 
 	areNewVids := len(latestVids) > 0
 	if areNewVids {
 		log.Printf("%s: %d vids of interest published (makes %d in total)",
 			w.pod, len(latestVids), len(w.vids))
 	}
-	var areNewProblems, problemResolved bool
 	for _, vi := range latestVids {
-		if err := w.download(vi, true); err != nil {
-			log.Printf("%s: %s download failed: %v", w.pod, vi.id, err)
-			w.problemVids[vi.id] = vi
-			areNewProblems = true
-		}
+		w.pendingVids.Put(vi.id)
+		w.sched.enqueue(w, vi, true)
 	}
 
-	// Try and resolve vids that had download problems during this (and
-	// previous) checks.
-	if areNewProblems {
-		log.Printf("%s: There are now %d problem vids",
-			w.pod, len(w.problemVids))
-	}
-	for _, vi := range w.problemVids {
-		err := w.download(vi, false)
-		if err == nil {
-			delete(w.problemVids, vi.id)
-			problemResolved = true
-			log.Printf("%s: Resolved problem vid %s", w.pod, vi.id)
+	// Try and resolve vids that had download problems during previous checks,
+	// if it's time to do so.
+	for _, pv := range w.problemVids {
+		if pv.due() {
+			w.sched.enqueue(w, pv.vi, false)
 		}
 	}
 
-	// Write the podcast feed XML to disk.
-	if areNewVids || problemResolved {
-		if err := w.writeFeed(); err != nil {
-			log.Printf("%s: Writing feed failed: %v", w.pod, err)
-		} else {
-			lastTimeAnyFeedWritten.Set(time.Now())
-		}
+	// Write the podcast feed XML to disk. The feed is written again as each
+	// download finishes.
+	if areNewVids || w.feedOutdated {
+		w.writeFeedAndLog()
+	}
+	if err := w.saveState(); err != nil {
+		log.Printf("%s: Saving state failed: %v", w.pod, err)
 	}
 
 	if w.initialCheck {
@@ -162,6 +275,83 @@ func (w *watcher) processLatest(latestVids []ytVidInfo) {
 	}
 }
 
+// Called by the download scheduler once it has attempted to download vi.
+func (w *watcher) downloadFinished(vi ytVidInfo, err error) {
+	// If the API didn't say how long the vid is, find out from the episode
+	// file. Do so before taking the lock, because it takes a moment.
+	var probedDuration time.Duration
+	if err == nil && vi.duration == 0 {
+		var probeErr error
+		probedDuration, probeErr = probeDuration(w.ctx, vi.episodePath(w.fileExtension()))
+		if probeErr != nil {
+			log.Printf("%s: Finding out duration of %s failed: %v", w.pod, vi.id, probeErr)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped || !w.isKnownVid(vi.id) {
+		// If the vid is no longer known, the watcher has been reconfigured
+		// since the download was queued.
+		return
+	}
+
+	w.pendingVids.Remove(vi.id)
+	if err != nil {
+		var dlErr *downloadError
+		if !errors.As(err, &dlErr) {
+			dlErr = &downloadError{class: dlErrTransient, reason: "transient error", err: err}
+		}
+		pv, already := w.problemVids[vi.id]
+		if !already {
+			pv = &problemVid{vi: vi}
+			w.problemVids[vi.id] = pv
+		}
+		pv.failed(dlErr)
+		w.logProblem(pv, err)
+		if !already {
+			log.Printf("%s: There are now %d problem vids",
+				w.pod, len(w.problemVids))
+		}
+		metrics.podcast(w.pod.ShortName).downloadsFailed.Add(1)
+	} else {
+		if _, wasProblem := w.problemVids[vi.id]; wasProblem {
+			delete(w.problemVids, vi.id)
+			log.Printf("%s: Resolved problem vid %s", w.pod, vi.id)
+		}
+		metrics.podcast(w.pod.ShortName).downloadsSucceeded.Add(1)
+		if probedDuration > 0 {
+			w.setVidDuration(vi.id, probedDuration)
+		}
+		w.writeFeedAndLog()
+	}
+	w.problemsChanged()
+	if err := w.saveState(); err != nil {
+		log.Printf("%s: Saving state failed: %v", w.pod, err)
+	}
+}
+
+// The caller must hold w.mu.
+func (w *watcher) writeFeedAndLog() {
+	if err := w.writeFeed(); err != nil {
+		log.Printf("%s: Writing feed failed: %v", w.pod, err)
+	} else {
+		lastTimeAnyFeedWritten.Set(time.Now())
+		metrics.podcast(w.pod.ShortName).feedWritten.Store(time.Now().Unix())
+		podcastHealths.feedWritten(w.pod.ShortName)
+		w.feedOutdated = false
+	}
+}
+
+func (w *watcher) isKnownVid(id string) bool {
+	for _, vi := range w.vids {
+		if vi.id == id {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *watcher) formatSelector() string {
 	if w.pod.Video {
 		return w.cfg.YTDLVideoFmtSelector
@@ -178,40 +368,106 @@ func (w *watcher) fileExtension() string {
 	}
 }
 
-func (w *watcher) download(vi ytVidInfo, firstTry bool) error {
-	diskPath := vi.episodePath(w.fileExtension())
+func (w *watcher) download(ctx context.Context, vi ytVidInfo, firstTry bool, prog *downloadProgress) error {
+	ext := w.fileExtension()
+	diskPath := vi.episodePath(ext)
 	if _, err := os.Stat(diskPath); err == nil {
 		return nil
 	}
+	partialPath := vi.partialEpisodePath(ext)
+	// In case an earlier attempt left anything behind.
+	vi.removePartialEpisodeFiles(ext)
 
-	cmdLine := fmt.Sprintf("%s -f %s -o %s --socket-timeout 30 -- %s",
-		w.cfg.DownloaderName, w.formatSelector(), diskPath, vi.id)
+	cmdLine := fmt.Sprintf("%s -f %s -o %s --socket-timeout 30 --newline -- %s",
+		w.cfg.DownloaderName, w.formatSelector(), partialPath, vi.id)
 	if firstTry {
 		log.Printf("%s: Download intent: %s", w.pod, cmdLine)
 	}
 
 	var errBuf bytes.Buffer
 	cmdLineSplit := strings.Split(cmdLine, " ")
-	cmd := exec.Command(cmdLineSplit[0], cmdLineSplit[1:]...)
+	cmd := exec.CommandContext(ctx, cmdLineSplit[0], cmdLineSplit[1:]...)
 	cmd.Stderr = &errBuf
+	// Don't wait indefinitely for any child processes of the downloader (e.g.
+	// ffmpeg) to let go of its output after it has been killed.
+	cmd.WaitDelay = downloaderWaitDelay
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
 
-	err := cmd.Run()
+	err = cmd.Start()
+	if err == nil {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			prog.update(scanner.Text())
+		}
+		// Progress reporting is best-effort, but the rest of the output must
+		// still be read, otherwise the downloader may block writing it.
+		if err := scanner.Err(); err != nil {
+			log.Printf("%s: Reading download progress of %s failed: %v", w.pod, vi.id, err)
+		}
+		io.Copy(io.Discard, stdout)
+		err = cmd.Wait()
+	}
 	if err != nil {
-		err = fmt.Errorf("%w: %s", err, errBuf.String())
+		vi.removePartialEpisodeFiles(ext)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			reason := "download cancelled"
+			if errors.Is(ctxErr, context.DeadlineExceeded) {
+				reason = "download timed out"
+			}
+			return &downloadError{class: dlErrTransient, reason: reason, err: fmt.Errorf("%w: %w", ctxErr, err)}
+		}
+		return classifyDownloadError(err, errBuf.String())
+	}
+	if err := verifyEpisodeFile(partialPath, ext, w.cfg.VerifyEpisodes); err != nil {
+		vi.removePartialEpisodeFiles(ext)
+		return &downloadError{class: dlErrTransient, reason: "integrity check failed", err: err}
+	}
+
+	chapters := parseChapters(vi.desc)
+	w.mu.Lock()
+	embedChaps := w.pod.EmbedChapters
+	subtitleLangs := w.pod.SubtitleLangs
+	w.mu.Unlock()
+	if embedChaps && len(chapters) > 0 {
+		// The episode is still worth having without them.
+		if err := embedChapters(ctx, partialPath, ext, chapters, vi.duration); err != nil {
+			log.Printf("%s: Embedding chapters into %s failed: %v", w.pod, vi.id, err)
+		}
+	}
+	if err := os.Rename(partialPath, diskPath); err != nil {
+		return err
+	}
+	if _, err := vi.writeChaptersFile(chapters); err != nil {
+		log.Printf("%s: Writing chapters of %s failed: %v", w.pod, vi.id, err)
+	}
+
+	// Likewise, the episode is still worth having without subtitles.
+	if len(subtitleLangs) > 0 {
+		lang, err := w.fetchSubtitles(ctx, vi, subtitleLangs)
+		switch {
+		case err != nil:
+			log.Printf("%s: Fetching subtitles of %s failed: %v", w.pod, vi.id, err)
+		case lang == "":
+			log.Printf("%s: %s has no subtitles in %s", w.pod, vi.id, strings.Join(subtitleLangs, ", "))
+		}
 	}
-	return err
+	return nil
 }
 
+// Returns the URL of the file at filePath. For a private podcast, the URL has
+// a placeholder that is replaced with a subscriber's token.
 func (w *watcher) buildURL(filePath string) string {
-	var portPart string
-	if w.cfg.ServePort != 80 {
-		portPart = fmt.Sprintf(":%d", w.cfg.ServePort)
-	}
+	return w.buildPublicURL(w.pod.urlPrefix() + filePath)
+}
 
+func (w *watcher) buildPublicURL(filePath string) string {
 	if w.cfg.LinkProxy != "" {
 		return fmt.Sprintf("%s/%s", strings.TrimSuffix(w.cfg.LinkProxy, "/"), filePath)
 	} else {
-		return fmt.Sprintf("http://%s%s/%s", w.cfg.ServeHost, portPart, filePath)
+		return buildServeURL(w.cfg, filePath)
 	}
 }
 
@@ -220,12 +476,26 @@ func (w *watcher) writeFeed() error {
 	// to podcast client users.
 	feedDesc := new(bytes.Buffer)
 	feedDesc.WriteString(w.pod.Description)
+	if feedDesc.Len() == 0 && w.pod.YTPlaylist != "" {
+		feedDesc.WriteString(w.pod.YTPlaylistDescription)
+	}
 	if feedDesc.Len() == 0 {
 		// No custom description was provided in the config. Derive one from
 		// the rest of the config.
-		fmt.Fprint(feedDesc,
-			"Generated based on the videos of YouTube channel ",
-			w.pod.YTChannelReadableName)
+		switch {
+		case w.pod.YTPlaylist != "":
+			fmt.Fprint(feedDesc,
+				"Generated based on the videos of YouTube playlist ",
+				w.pod.YTPlaylistTitle)
+		case len(w.pod.YTChannels) == 1:
+			fmt.Fprint(feedDesc,
+				"Generated based on the videos of YouTube channel ",
+				w.pod.channelsReadableName())
+		default:
+			fmt.Fprint(feedDesc,
+				"Generated based on the videos of YouTube channels ",
+				w.pod.channelsReadableName())
+		}
 		if !w.pod.Epoch.IsZero() {
 			fmt.Fprintf(feedDesc, " published from %s onwards", w.pod.EpochStr)
 		}
@@ -234,26 +504,62 @@ func (w *watcher) writeFeed() error {
 		}
 	}
 
-	// Use the podcasts package to construct the XML for the file.
-	var homeLink string
-	switch w.pod.YTChannelHandleFormat {
-	case LegacyUsername:
-		homeLink = youtubeUserUrlPrefix + w.pod.YTChannelHandle
-	case ChannelID:
-		homeLink = youtubeChannelUrlPrefix + w.pod.YTChannelHandle
+	var homeLink, copyright string
+	title := w.pod.Name
+	if w.pod.YTPlaylist != "" {
+		homeLink = youtubePlaylistUrlPrefix + w.pod.YTPlaylist
+		copyright = w.pod.YTPlaylistOwner
+		if title == "" {
+			title = w.pod.YTPlaylistTitle
+		}
+	} else {
+		// When there are multiple channels, the first is considered the main
+		// one.
+		homeLink = w.pod.YTChannels[0].homeLink()
+		copyright = w.pod.channelsReadableName()
 	}
-	feedBuilder := &podcasts.Podcast{
-		Title:       w.pod.Name,
+	channel := &rssChannel{
+		Title:       title,
 		Link:        homeLink,
-		Copyright:   w.pod.YTChannelReadableName,
+		Copyright:   copyright,
 		Language:    "en",
 		Description: feedDesc.String(),
+
+		ItunesAuthor:   copyright,
+		ItunesExplicit: itunesBool(w.pod.Explicit),
+		ItunesSummary:  &rssCDATA{feedDesc.String()},
+		ItunesImage:    &itunesImage{Href: w.buildURL(w.pod.artPath())},
+	}
+	if w.pod.ItunesOwnerEmail != "" {
+		ownerName := w.pod.ItunesOwnerName
+		if ownerName == "" {
+			ownerName = copyright
+		}
+		channel.ItunesOwner = &itunesOwner{Name: ownerName, Email: w.pod.ItunesOwnerEmail}
+	}
+	if cat := parseItunesCategory(w.pod.ItunesCategory); cat != nil {
+		channel.ItunesCategories = []*itunesCategory{cat}
+	}
+	if w.pod.PodcastNamespace {
+		w.addPodcastNamespaceToChannel(channel)
 	}
 
-	// Sort so that episodes in the feed are ordered newest to oldest.
-	sort.Sort(sort.Reverse(vidsChronoSorter(w.vids)))
+	// Sort a copy, because the watch goroutine reads w.vids without holding
+	// the lock.
+	vids := slices.Clone(w.vids)
+	if w.pod.PlaylistOrder == playlistOrderPlaylist {
+		// Sort so that episodes in the feed are ordered as in the playlist.
+		sort.Stable(vidsPlaylistSorter{vids, w.playlistPositions})
+	} else {
+		// Sort so that episodes in the feed are ordered newest to oldest.
+		sort.Sort(sort.Reverse(vidsChronoSorter(vids)))
+	}
 
-	for _, vi := range w.vids {
+	companions, err := readCompanionFiles()
+	if err != nil {
+		log.Printf("%s: Looking for episodes' companion files failed: %v", w.pod, err)
+	}
+	for _, vi := range vids {
 		diskPath := vi.episodePath(w.fileExtension())
 		f, err := os.Open(diskPath)
 		if err != nil {
@@ -268,7 +574,7 @@ func (w *watcher) writeFeed() error {
 		}
 		epSize := info.Size()
 		epURL := w.buildURL(diskPath)
-		epSummary := &podcasts.ItunesSummary{
+		epSummary := &rssCDATA{
 			Value: fmt.Sprintf(
 				`%s // <a href="%s/watch?v=%s">Link to original YouTube video</a>`,
 				vi.desc,
@@ -282,27 +588,41 @@ func (w *watcher) writeFeed() error {
 		}
 		enclosureType = fmt.Sprint(enclosureType, "/", w.fileExtension())
 
-		feedBuilder.AddItem(&podcasts.Item{
+		season, episode := parseEpisodeNumbering(vi.title)
+		item := &rssItem{
 			Title:   vi.title,
-			Summary: epSummary,
-			GUID:    epURL,
-			PubDate: &podcasts.PubDate{Time: vi.published},
-			Enclosure: &podcasts.Enclosure{
+			GUID:    w.episodeGUID(&vi),
+			PubDate: rssDate(vi.published),
+			Enclosure: &rssEnclosure{
 				URL:    epURL,
-				Length: fmt.Sprint(epSize),
+				Length: epSize,
 				Type:   enclosureType,
 			},
-		})
-	}
-	feed, err := feedBuilder.Feed(
-		// Apply iTunes-specific XML elements.
-		podcasts.Author(feedBuilder.Copyright),
-		podcasts.Summary(feedBuilder.Description),
-		podcasts.Image(w.buildURL(w.pod.artPath())))
-	if err != nil {
-		return err
+			ItunesDuration:    itunesDuration(vi.duration),
+			ItunesExplicit:    itunesBool(w.pod.Explicit || vi.ageRestricted),
+			ItunesSummary:     epSummary,
+			ItunesEpisodeType: episodeType(vi.title),
+			ItunesSeason:      season,
+			ItunesEpisode:     episode,
+		}
+		if vi.thumbnail != "" {
+			item.ItunesImage = &itunesImage{Href: vi.thumbnail}
+		}
+		if w.pod.PlaylistOrder == playlistOrderPlaylist {
+			if pos, ok := w.playlistPositions[vi.id]; ok {
+				// Tell clients to present episodes in the playlist's order
+				// rather than by publish date.
+				item.ItunesOrder = int(pos) + 1
+			}
+		}
+		if w.pod.podcastNamespaceInFeed() {
+			w.addPodcastNamespaceToItem(item, companions[vi.id])
+		}
+		channel.Items = append(channel.Items, item)
 	}
 
+	w.registerPaths(vids, companions)
+
 	// Write the feed XML to disk.
 	f, err := os.OpenFile(w.pod.feedPath(),
 		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, stdext.OwnerWritableReg)
@@ -311,41 +631,107 @@ func (w *watcher) writeFeed() error {
 	}
 	defer f.Close()
 	log.Printf("%s: Writing out feed", w.pod)
-	if err := feed.Write(f); err != nil {
+	if err := newRSSFeed(channel, w.pod.podcastNamespaceInFeed()).write(f); err != nil {
 		return err
 	}
 	fmt.Fprintln(f)
 	return nil
 }
 
-func (w *watcher) getLatest(pubdAfter time.Time) ([]ytVidInfo, error) {
+// Record which files belong to the podcast, so access to them can be
+// controlled.
+func (w *watcher) registerPaths(vids []ytVidInfo, companions map[string][]companionFile) {
+	paths := []string{w.pod.feedPath(), w.pod.artPath(), w.pod.statePath()}
+	for _, vi := range vids {
+		paths = append(paths, vi.episodePath(w.fileExtension()))
+		for _, cf := range companions[vi.id] {
+			paths = append(paths, cf.path)
+		}
+	}
+	podcastAccessControl.setPaths(w.pod.ShortName, paths)
+}
+
+// Query for vids of interest published after pubdAfter. Also returns the time
+// the check began, which the next check can query from.
+func (w *watcher) getLatest(pubdAfter time.Time) ([]ytVidInfo, time.Time, error) {
+	checkTime := time.Now()
+	if w.pod.YTPlaylist != "" {
+		latestVids, err := w.getLatestFromPlaylist()
+		if err != nil {
+			return nil, checkTime, err
+		}
+		return latestVids, checkTime, nil
+	}
+
+	var latestVids []ytVidInfo
+	seen := mapset.New[string]()
+	for i := range w.pod.YTChannels {
+		src := &w.pod.YTChannels[i]
+		srcVids, err := w.getLatestFromChannel(src, pubdAfter)
+		if err != nil {
+			return nil, checkTime, fmt.Errorf("%s: %w", src, err)
+		}
+		for _, vi := range srcVids {
+			// The same vid can turn up more than once, e.g. if it was
+			// published after the previous check began but before the request
+			// that covered it was made.
+			if seen.Has(vi.id) || w.isKnownVid(vi.id) {
+				continue
+			}
+			seen.Put(vi.id)
+			latestVids = append(latestVids, vi)
+		}
+	}
+	return latestVids, checkTime, nil
+}
+
+func (w *watcher) getLatestFromChannel(src *channelSource, pubdAfter time.Time) ([]ytVidInfo, error) {
+	switch w.pod.Discovery {
+	case discoveryPlaylist:
+		return w.getLatestFromUploads(src, pubdAfter)
+	case discoveryFeed:
+		if w.lastChecked.IsZero() {
+			// The feed can't be used for backfilling.
+			return w.getLatestFromUploads(src, pubdAfter)
+		}
+		latestVids, err := w.getLatestFromFeed(src, pubdAfter)
+		if err != nil {
+			log.Printf("%s: Getting latest vids of %s from feed failed, so falling back to the API: %v", w.pod, src, err)
+			return w.getLatestFromUploads(src, pubdAfter)
+		}
+		return latestVids, nil
+	default:
+		return w.getLatestFromSearch(src, pubdAfter)
+	}
+}
+
+func (w *watcher) getLatestFromSearch(src *channelSource, pubdAfter time.Time) ([]ytVidInfo, error) {
 	var (
 		latestVids    []ytVidInfo
 		nextPageToken string
 	)
 	for {
 		apiReq := w.ytAPI.Search.List([]string{"id", "snippet"}).
-			ChannelId(w.pod.YTChannelID).
+			ChannelId(src.YTChannelID).
 			Type("video").
 			PublishedAfter(pubdAfter.Format(time.RFC3339)).
 			Order("date").
 			MaxResults(50).
 			PageToken(nextPageToken)
-		if w.pod.TitleFilterIsLiteral && w.pod.TitleFilter != "" {
+		if src.TitleFilterIsLiteral && src.TitleFilter != "" {
 			// When the user-specified title filter is a plain literal
 			// (doesn't use any regex syntax) then filtering can be done
 			// server-side. This can save on API quota usage by reducing the
 			// number of pages of results that need to be requested.
-			apiReq = apiReq.Q(w.pod.TitleFilter)
+			apiReq = apiReq.Q(src.TitleFilter)
 		}
-		checkTime := time.Now()
+		w.countAPICall(ytAPISearchList)
 		apiResp, err := apiReq.Do()
 		if err != nil {
 			// Don't hammer on the API if it's down or isn't happy.
 			w.ytAPIRespite = ytAPIRespiteUnit
 			return nil, err
 		}
-		w.lastChecked = checkTime
 		for _, item := range apiResp.Items {
 			if item.Id.Kind != "youtube#video" {
 				return nil, errors.New("non-video in response items")
@@ -353,7 +739,7 @@ func (w *watcher) getLatest(pubdAfter time.Time) ([]ytVidInfo, error) {
 			// Even if we requested server-side filtering, that is fuzzy and
 			// often returns false-positives, so we always do client-side
 			// filtering.
-			if !w.pod.TitleFilterRE.MatchString(html.UnescapeString(item.Snippet.Title)) {
+			if !src.TitleFilterRE.MatchString(html.UnescapeString(item.Snippet.Title)) {
 				// Not interested in this vid.
 				continue
 			}
@@ -373,56 +759,138 @@ func (w *watcher) getLatest(pubdAfter time.Time) ([]ytVidInfo, error) {
 	return latestVids, nil
 }
 
-var ytChannelIDFormat = regexp.MustCompile("UC[[:alnum:]_-]{22}")
+func (w *watcher) getLatestFromUploads(src *channelSource, pubdAfter time.Time) ([]ytVidInfo, error) {
+	var (
+		latestVids []ytVidInfo
+		pageHasNew bool
+	)
+	err := w.pagePlaylistItems(src.YTUploadsPlaylistID, func(item *youtube.PlaylistItem, pubd time.Time) {
+		if w.isKnownVid(item.ContentDetails.VideoId) {
+			return
+		}
+		if pubd.After(pubdAfter) {
+			pageHasNew = true
+		}
+		// The uploads playlist is only roughly ordered newest to oldest (e.g. a
+		// vid that was uploaded privately and made public later keeps its
+		// place), so rather than disregarding vids published before the last
+		// check, disregard those that are already known about.
+		if !pubd.After(w.pod.Epoch) {
+			return
+		}
+		// Unlike with Search.List, filtering can only be done client-side.
+		if !src.TitleFilterRE.MatchString(html.UnescapeString(item.Snippet.Title)) {
+			return
+		}
+		latestVids = append(
+			latestVids,
+			makeYtVidInfo(item.ContentDetails.VideoId, pubd, item.Snippet.Title, item.Snippet.Description))
+	}, func() bool {
+		// Once a whole page has nothing new on it, nothing of interest is
+		// likely to remain beyond it.
+		more := pageHasNew
+		pageHasNew = false
+		return more
+	})
+	if err != nil {
+		return nil, err
+	}
+	return latestVids, nil
+}
 
-func (w *watcher) getChannelInfo() error {
-	apiReq := w.ytAPI.Channels.List([]string{"id", "snippet"}).MaxResults(1)
+var ytChannelIDFormat = regexp.MustCompile("^UC[[:alnum:]_-]{22}$")
 
-	switch w.pod.YTChannelHandleFormat {
+func (w *watcher) getChannelsInfo() error {
+	// When there are multiple channels, the first is considered the main one,
+	// so its image is used.
+	for i := range w.pod.YTChannels {
+		srcThumbURL, err := w.getChannelInfo(&w.pod.YTChannels[i])
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			w.thumbURL = srcThumbURL
+		}
+	}
+	return w.writeArt()
+}
+
+// Returns the URL of the channel's image, or the empty string if it couldn't
+// be discovered.
+func (w *watcher) getChannelInfo(src *channelSource) (string, error) {
+	apiReq := w.ytAPI.Channels.List([]string{"id", "snippet", "contentDetails"}).MaxResults(1)
+
+	switch src.YTChannelHandleFormat {
 	case LegacyUsername:
-		apiReq = apiReq.ForUsername(w.pod.YTChannelHandle)
+		apiReq = apiReq.ForUsername(src.YTChannelHandle)
 	case ChannelID:
-		apiReq = apiReq.Id(w.pod.YTChannelHandle)
+		apiReq = apiReq.Id(src.YTChannelHandle)
+	case Handle:
+		apiReq = apiReq.ForHandle(src.YTChannelHandle)
+	case CustomURL:
+		id, err := w.resolveCustomURL(src)
+		if err != nil {
+			return "", err
+		}
+		apiReq = apiReq.Id(id)
 	}
 
 	var channel *youtube.Channel
+	w.countAPICall(ytAPIChannelsList)
 	apiResp, err := apiReq.Do()
 	if err != nil {
-		log.Printf("%s: Getting initial channel info failed: %v", w.pod, err)
+		log.Printf("%s: Getting initial channel info for %s failed: %v", w.pod, src, err)
 	} else {
 		switch n := len(apiResp.Items); n {
 		case 0:
-			return fmt.Errorf("%s: could not find a channel by using the handle %q", w.pod, w.pod.YTChannelHandle)
+			return "", fmt.Errorf("%s: could not find a channel by using the handle %q", w.pod, src.YTChannelHandle)
 		case 1:
 			if item := apiResp.Items[0]; item.Kind == "youtube#channel" {
 				channel = item
 			} else {
-				return fmt.Errorf("%s: unexpected Kind %q in initial channel info", w.pod, item.Kind)
+				return "", fmt.Errorf("%s: unexpected Kind %q in initial channel info", w.pod, item.Kind)
 			}
 		default:
-			return fmt.Errorf("%s: expected exactly 1 item in initial channel info response, got %d", w.pod, n)
+			return "", fmt.Errorf("%s: expected exactly 1 item in initial channel info response, got %d", w.pod, n)
 		}
 	}
 
 	if channel != nil {
 		// We have now been made aware of the channel's ChannelID regardless of
 		// what format of handle was specified in the config file.
-		w.pod.YTChannelID = channel.Id
+		src.YTChannelID = channel.Id
 
-		w.pod.YTChannelReadableName = channel.Snippet.Title
+		src.YTChannelReadableName = channel.Snippet.Title
+		if channel.ContentDetails != nil && channel.ContentDetails.RelatedPlaylists != nil {
+			src.YTUploadsPlaylistID = channel.ContentDetails.RelatedPlaylists.Uploads
+		}
 	} else {
-		if w.pod.YTChannelHandleFormat == ChannelID {
-			w.pod.YTChannelID = w.pod.YTChannelHandle
+		if src.YTChannelHandleFormat == ChannelID {
+			src.YTChannelID = src.YTChannelHandle
 		} else {
-			return fmt.Errorf(
+			return "", fmt.Errorf(
 				"%s: Cannot continue due to being unable to discover the ChannelID for %q using the YT API. HINT: In the config file, writing the channel's ID (\"UC...\") directly instead of %[2]q may resolve this",
-				w.pod, w.pod.YTChannelHandle)
+				w.pod, src.YTChannelHandle)
 		}
-		log.Printf("%s: Unable to discover channel's readable name using the YT API, so making do with the handle from the config file", w.pod)
-		w.pod.YTChannelReadableName = w.pod.YTChannelHandle
+		log.Printf("%s: Unable to discover the readable name of %s using the YT API, so making do with the handle from the config file", w.pod, src)
+		src.YTChannelReadableName = src.YTChannelHandle
+	}
+	if src.YTUploadsPlaylistID == "" {
+		// By convention, a channel's uploads playlist ID is its ChannelID with
+		// the "UC" prefix swapped for "UU".
+		src.YTUploadsPlaylistID = "UU" + strings.TrimPrefix(src.YTChannelID, "UC")
 	}
 
-	chImg, err := w.getChannelImage(channel)
+	if channel == nil {
+		return "", nil
+	}
+	return channel.Snippet.Thumbnails.High.Url, nil
+}
+
+// Write the podcast's artwork to disk, based on the image at w.thumbURL, unless
+// a custom image has been configured.
+func (w *watcher) writeArt() error {
+	chImg, err := w.getArtImage(w.thumbURL)
 	if err != nil {
 		return err
 	}
@@ -452,7 +920,40 @@ func (w *watcher) getChannelInfo() error {
 	return jpeg.Encode(f, chImg, nil)
 }
 
-func (w *watcher) getChannelImage(channel *youtube.Channel) (image.Image, error) {
+// Discover the ChannelID of the channel with the Custom URL that was specified
+// in the config file.
+func (w *watcher) resolveCustomURL(src *channelSource) (string, error) {
+	// Channels that had a Custom URL have usually since been given a @handle
+	// with the same name, which is the cheap and unambiguous thing to check.
+	w.countAPICall(ytAPIChannelsList)
+	chResp, err := w.ytAPI.Channels.List([]string{"id"}).
+		ForHandle(src.YTChannelHandle).
+		MaxResults(1).
+		Do()
+	if err == nil && len(chResp.Items) == 1 {
+		return chResp.Items[0].Id, nil
+	}
+
+	// Otherwise, fall back to the most relevant channel search result.
+	w.countAPICall(ytAPISearchList)
+	searchResp, err := w.ytAPI.Search.List([]string{"snippet"}).
+		Type("channel").
+		Q(src.YTChannelHandle).
+		MaxResults(1).
+		Do()
+	if err != nil {
+		return "", fmt.Errorf("%s: resolving custom URL %q: %w", w.pod, src.YTChannelHandle, err)
+	}
+	if len(searchResp.Items) == 0 {
+		return "", fmt.Errorf("%s: could not find a channel by using the custom URL %q", w.pod, src.YTChannelHandle)
+	}
+	id := searchResp.Items[0].Snippet.ChannelId
+	log.Printf("%s: Resolved custom URL %q to ChannelID %s by searching. If that's the wrong channel, specify its ID in the config file instead",
+		w.pod, src.YTChannelHandle, id)
+	return id, nil
+}
+
+func (w *watcher) getArtImage(thumbURL string) (image.Image, error) {
 	if w.pod.CustomImagePath != "" {
 		if w.pod.CustomImagePath == w.pod.artPath() {
 			return nil, fmt.Errorf(
@@ -471,12 +972,12 @@ func (w *watcher) getChannelImage(channel *youtube.Channel) (image.Image, error)
 		log.Printf("%s: Using custom image from path %s", w.pod, w.pod.CustomImagePath)
 		return img, nil
 	} else {
-		if channel == nil {
+		if thumbURL == "" {
 			log.Printf("%s: Unable to discover channel's image using the YT API, so making do with placeholder art", w.pod)
 			return png.Decode(bytes.NewReader(placeholderArtPNG))
 		}
 
-		imgResp, err := http.Get(channel.Snippet.Thumbnails.High.Url)
+		imgResp, err := http.Get(thumbURL)
 		if err != nil {
 			return nil, err
 		}
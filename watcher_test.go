@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+// Serve pages of playlist items (keyed by playlist ID) the way the YouTube
+// Data API does, returning the API and a count of the pages requested.
+func newTestYTAPI(t *testing.T, playlists map[string][][]*youtube.PlaylistItem) (*youtube.Service, *int) {
+	t.Helper()
+	var requested int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/playlistItems") {
+			http.NotFound(w, r)
+			return
+		}
+		requested++
+		pages, ok := playlists[r.URL.Query().Get("playlistId")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		resp := youtube.PlaylistItemListResponse{Items: pages[page]}
+		if page+1 < len(pages) {
+			resp.NextPageToken = strconv.Itoa(page + 1)
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+	t.Cleanup(srv.Close)
+	ytAPI, err := youtube.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithAPIKey("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ytAPI, &requested
+}
+
+func testPlaylistItem(id, title string, position int64, published time.Time) *youtube.PlaylistItem {
+	return &youtube.PlaylistItem{
+		Snippet: &youtube.PlaylistItemSnippet{Title: title, Position: position},
+		ContentDetails: &youtube.PlaylistItemContentDetails{
+			VideoId:          id,
+			VideoPublishedAt: published.Format(time.RFC3339),
+		},
+	}
+}
+
+func TestGetLatestFromUploads(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC) }
+	item := func(id string, d int) *youtube.PlaylistItem {
+		return testPlaylistItem(id, "Episode "+id, 0, day(d))
+	}
+	deleted := &youtube.PlaylistItem{Snippet: &youtube.PlaylistItemSnippet{Title: "Deleted video"}}
+
+	for _, tc := range []struct {
+		name      string
+		pages     [][]*youtube.PlaylistItem
+		known     []string
+		pubdAfter time.Time
+		epoch     time.Time
+		filter    string
+		wantIDs   []string
+		wantPages int
+	}{
+		{
+			name: "first check pages through everything after the epoch",
+			pages: [][]*youtube.PlaylistItem{
+				{item("e", 10), deleted, item("d", 9)},
+				{item("c", 8), item("b", 7)},
+				{item("a", 1)},
+			},
+			epoch:     day(5),
+			pubdAfter: day(5),
+			wantIDs:   []string{"e", "d", "c", "b"},
+			wantPages: 3,
+		},
+		{
+			name: "stops after a page with nothing new",
+			pages: [][]*youtube.PlaylistItem{
+				{item("e", 10), item("d", 9)},
+				{item("c", 8), item("b", 7)},
+				{item("a", 6)},
+			},
+			known:     []string{"d", "c", "b", "a"},
+			pubdAfter: day(9),
+			wantIDs:   []string{"e"},
+			wantPages: 2,
+		},
+		{
+			name: "late arrival published before the last check",
+			pages: [][]*youtube.PlaylistItem{
+				{item("e", 10), item("late", 3), item("d", 9)},
+				{item("c", 8)},
+			},
+			known:     []string{"e", "d", "c"},
+			pubdAfter: day(10),
+			wantIDs:   []string{"late"},
+			wantPages: 1,
+		},
+		{
+			name: "title filter",
+			pages: [][]*youtube.PlaylistItem{
+				{testPlaylistItem("b", "Podcast #2", 0, day(2)), testPlaylistItem("s", "Shorts", 0, day(2)), testPlaylistItem("a", "Podcast #1", 0, day(1))},
+			},
+			filter:    "podcast",
+			wantIDs:   []string{"b", "a"},
+			wantPages: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ytAPI, requested := newTestYTAPI(t, map[string][][]*youtube.PlaylistItem{
+				"UUabcdefghijklmnopqrstuv": tc.pages,
+			})
+			w := &watcher{
+				ytAPI: ytAPI,
+				pod:   &podcast{ShortName: "example", Epoch: tc.epoch},
+			}
+			for _, id := range tc.known {
+				w.vids = append(w.vids, ytVidInfo{id: id})
+			}
+			src := &channelSource{
+				YTUploadsPlaylistID: "UUabcdefghijklmnopqrstuv",
+				TitleFilterRE:       regexp.MustCompile("(?i:" + tc.filter + ")"),
+			}
+
+			vids, err := w.getLatestFromUploads(src, tc.pubdAfter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, vi := range vids {
+				ids = append(ids, vi.id)
+			}
+			if !slices.Equal(ids, tc.wantIDs) {
+				t.Errorf("got vids %v, want %v", ids, tc.wantIDs)
+			}
+			if *requested != tc.wantPages {
+				t.Errorf("requested %d pages, want %d", *requested, tc.wantPages)
+			}
+		})
+	}
+}
+
+func TestGetLatestFromUploadsAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"code": 403, "message": "quota exceeded"}}`, http.StatusForbidden)
+	}))
+	defer srv.Close()
+	ytAPI, err := youtube.NewService(context.Background(), option.WithEndpoint(srv.URL), option.WithAPIKey("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &watcher{ytAPI: ytAPI, pod: &podcast{ShortName: "example"}}
+	if _, err := w.getLatestFromUploads(&channelSource{TitleFilterRE: regexp.MustCompile("")}, time.Time{}); err == nil {
+		t.Fatal("no error")
+	}
+	if w.ytAPIRespite == 0 {
+		t.Error("API not given respite after an error")
+	}
+}
+
+func TestGetLatestMergesChannels(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC) }
+	// A collab is uploaded by one channel and added to the other's uploads
+	// too.
+	ytAPI, _ := newTestYTAPI(t, map[string][][]*youtube.PlaylistItem{
+		"UUmainmainmainmainmainmai": {{
+			testPlaylistItem("collab", "Collab", 0, day(4)),
+			testPlaylistItem("main2", "Main 2", 0, day(3)),
+			testPlaylistItem("main1", "Main 1", 0, day(1)),
+		}},
+		"UUguestguestguestguestgue": {{
+			testPlaylistItem("guest2", "Guest 2", 0, day(5)),
+			testPlaylistItem("collab", "Collab", 0, day(4)),
+			testPlaylistItem("guest1", "Guest 1", 0, day(2)),
+		}},
+	})
+	everything := regexp.MustCompile("")
+	w := &watcher{
+		ytAPI: ytAPI,
+		pod: &podcast{
+			ShortName: "example",
+			Discovery: discoveryPlaylist,
+			YTChannels: []channelSource{
+				{YTChannelHandle: "main", YTUploadsPlaylistID: "UUmainmainmainmainmainmai", TitleFilterRE: everything},
+				{YTChannelHandle: "guest", YTUploadsPlaylistID: "UUguestguestguestguestgue", TitleFilterRE: regexp.MustCompile("Guest|Collab")},
+			},
+		},
+		vids: []ytVidInfo{{id: "main1"}},
+	}
+
+	vids, _, err := w.getLatest(day(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, vi := range vids {
+		ids = append(ids, vi.id)
+	}
+	if want := []string{"collab", "main2", "guest2", "guest1"}; !slices.Equal(ids, want) {
+		t.Errorf("got vids %v, want %v", ids, want)
+	}
+
+	// An error is attributed to the channel it came from.
+	w.pod.YTChannels[1].YTUploadsPlaylistID = "UUmissingmissingmissingmi"
+	if _, _, err := w.getLatest(day(1)); err == nil || !strings.HasPrefix(err.Error(), "guest: ") {
+		t.Errorf("error = %v, want one about the guest channel", err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 
@@ -12,6 +13,7 @@ import (
 // configuration file we're using.
 func clean(podcastCount int, cleanc <-chan *cleaningWhitelist) (int, error) {
 	keepers := mapset.New[string]()
+	keepers.Put(statsPath)
 
 	for i := 0; i < podcastCount; i++ {
 		wl := <-cleanc
@@ -61,12 +63,20 @@ type cleaningWhitelist struct {
 // so that they will not be removed.
 func (w *watcher) sendCleaningWhitelist(vids []ytVidInfo) {
 	wlist := cleaningWhitelist{cleanFinishedC: make(chan struct{})}
+	companions, err := readCompanionFiles()
+	if err != nil {
+		log.Printf("%s: Looking for episodes' companion files failed: %v", w.pod, err)
+	}
 	for _, vi := range vids {
 		wlist.paths = append(wlist.paths,
 			vi.episodePath(w.fileExtension()))
+		for _, cf := range companions[vi.id] {
+			wlist.paths = append(wlist.paths, cf.path)
+		}
 	}
 	wlist.paths = append(wlist.paths, w.pod.artPath())
 	wlist.paths = append(wlist.paths, w.pod.feedPath())
+	wlist.paths = append(wlist.paths, w.pod.statePath())
 	w.cleanc <- &wlist
 	<-wlist.cleanFinishedC
 }
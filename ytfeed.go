@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// YouTube publishes an Atom feed of each channel's most recent uploads. Polling
+// it doesn't use any YouTube Data API quota, but it only ever lists a limited
+// number of vids, so it can't be used for backfilling.
+
+const (
+	ytFeedDefaultBaseURL = "https://www.youtube.com/feeds/videos.xml"
+	ytFeedMaxEntries     = 15
+	ytFeedTimeout        = 30 * time.Second
+)
+
+var errYTFeedIncomplete = errors.New("feed doesn't reach back far enough")
+
+//nolint:gochecknoglobals
+var ytFeedHTTPClient = &http.Client{Timeout: ytFeedTimeout}
+
+type ytAtomFeed struct {
+	Entries []ytAtomEntry `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+type ytAtomEntry struct {
+	VideoID   string `xml:"http://www.youtube.com/xml/schemas/2015 videoId"`
+	Title     string `xml:"http://www.w3.org/2005/Atom title"`
+	Published string `xml:"http://www.w3.org/2005/Atom published"`
+	Media     struct {
+		Description string `xml:"http://search.yahoo.com/mrss/ description"`
+	} `xml:"http://search.yahoo.com/mrss/ group"`
+}
+
+func (w *watcher) getLatestFromFeed(src *channelSource, pubdAfter time.Time) ([]ytVidInfo, error) {
+	feedURL, err := url.Parse(w.cfg.YTFeedBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	q := feedURL.Query()
+	q.Set("channel_id", src.YTChannelID)
+	feedURL.RawQuery = q.Encode()
+
+	resp, err := ytFeedHTTPClient.Get(feedURL.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed responded with status %q", resp.Status)
+	}
+	var feed ytAtomFeed
+	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, err
+	}
+
+	var (
+		latestVids []ytVidInfo
+		reachedOld bool
+	)
+	for _, entry := range feed.Entries {
+		pubd, err := time.Parse(time.RFC3339, entry.Published)
+		if err != nil {
+			return nil, err
+		}
+		if !pubd.After(pubdAfter) {
+			reachedOld = true
+		}
+		// Vids can take a while to show up in the feed after they are
+		// published, so rather than disregarding those published before the
+		// last check, disregard those that are already known about.
+		if !pubd.After(w.pod.Epoch) || w.isKnownVid(entry.VideoID) {
+			continue
+		}
+		if !src.TitleFilterRE.MatchString(entry.Title) {
+			continue
+		}
+		// Unlike the API, the feed's text doesn't need HTML unescaping, so
+		// don't use makeYtVidInfo.
+		latestVids = append(latestVids, ytVidInfo{
+			id:        entry.VideoID,
+			published: pubd,
+			title:     entry.Title,
+			desc:      entry.Media.Description,
+		})
+	}
+	if !reachedOld && len(feed.Entries) >= ytFeedMaxEntries {
+		// There might be vids of interest that have already fallen off the
+		// end of the feed.
+		return nil, errYTFeedIncomplete
+	}
+	return latestVids, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ytFeedEntryFormat = `
+  <entry>
+    <id>yt:video:%[1]s</id>
+    <yt:videoId>%[1]s</yt:videoId>
+    <title>%[2]s</title>
+    <published>%[3]s</published>
+    <media:group>
+      <media:title>%[2]s</media:title>
+      <media:description>About %[2]s &amp; more</media:description>
+    </media:group>
+  </entry>`
+
+func ytFeedXML(entries ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns:yt="http://www.youtube.com/xml/schemas/2015" xmlns:media="http://search.yahoo.com/mrss/" xmlns="http://www.w3.org/2005/Atom">
+  <title>Example</title>` + strings.Join(entries, "") + `
+</feed>`
+}
+
+func TestGetLatestFromFeed(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC) }
+	entry := func(id, title string, published time.Time) string {
+		return fmt.Sprintf(ytFeedEntryFormat, id, title, published.Format(time.RFC3339))
+	}
+	// Newest first, as YouTube lists them.
+	fullFeed := make([]string, ytFeedMaxEntries)
+	for i := range fullFeed {
+		fullFeed[i] = entry(fmt.Sprintf("full%07d", i), "Episode", day(20-i))
+	}
+
+	for _, tc := range []struct {
+		name        string
+		feed        string
+		titleFilter string
+		epoch       time.Time
+		known       []string
+		pubdAfter   time.Time
+		wantIDs     []string
+		wantErr     error
+	}{
+		{
+			name: "new vids",
+			feed: ytFeedXML(
+				entry("ccccccccccc", "Third", day(3)),
+				entry("bbbbbbbbbbb", "Second", day(2)),
+				entry("aaaaaaaaaaa", "First", day(1))),
+			known:     []string{"aaaaaaaaaaa"},
+			pubdAfter: day(1),
+			wantIDs:   []string{"ccccccccccc", "bbbbbbbbbbb"},
+		},
+		{
+			name: "late arrival published before last check",
+			feed: ytFeedXML(
+				entry("ccccccccccc", "Third", day(3)),
+				entry("bbbbbbbbbbb", "Second", day(2)),
+				entry("aaaaaaaaaaa", "First", day(1))),
+			known:     []string{"ccccccccccc", "aaaaaaaaaaa"},
+			pubdAfter: day(3),
+			wantIDs:   []string{"bbbbbbbbbbb"},
+		},
+		{
+			name: "title filter and epoch",
+			feed: ytFeedXML(
+				entry("ccccccccccc", "Podcast #3", day(3)),
+				entry("bbbbbbbbbbb", "Shorts", day(2)),
+				entry("aaaaaaaaaaa", "Podcast #1", day(1))),
+			titleFilter: "podcast",
+			epoch:       day(1),
+			wantIDs:     []string{"ccccccccccc"},
+		},
+		{
+			name:      "full feed that doesn't reach back to the last check",
+			feed:      ytFeedXML(fullFeed...),
+			pubdAfter: day(1),
+			wantErr:   errYTFeedIncomplete,
+		},
+		{
+			name:      "full feed that reaches back to the last check",
+			feed:      ytFeedXML(fullFeed...),
+			pubdAfter: day(20 - ytFeedMaxEntries + 1),
+			known:     []string{fmt.Sprintf("full%07d", ytFeedMaxEntries-1)},
+			wantIDs: func() []string {
+				ids := make([]string, ytFeedMaxEntries-1)
+				for i := range ids {
+					ids[i] = fmt.Sprintf("full%07d", i)
+				}
+				return ids
+			}(),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Get("channel_id"); got != "UCabcdefghijklmnopqrstuv" {
+					t.Errorf("requested channel_id %q", got)
+				}
+				fmt.Fprint(w, tc.feed)
+			}))
+			defer srv.Close()
+
+			w := &watcher{
+				cfg: &config{YTFeedBaseURL: srv.URL + "/feeds/videos.xml"},
+				pod: &podcast{Epoch: tc.epoch},
+			}
+			for _, id := range tc.known {
+				w.vids = append(w.vids, ytVidInfo{id: id})
+			}
+			src := &channelSource{
+				YTChannelID:   "UCabcdefghijklmnopqrstuv",
+				TitleFilterRE: regexp.MustCompile("(?i:" + tc.titleFilter + ")"),
+			}
+
+			vids, err := w.getLatestFromFeed(src, tc.pubdAfter)
+			if err != tc.wantErr {
+				t.Fatalf("error = %v, want %v", err, tc.wantErr)
+			}
+			var ids []string
+			for _, vi := range vids {
+				ids = append(ids, vi.id)
+			}
+			if strings.Join(ids, ",") != strings.Join(tc.wantIDs, ",") {
+				t.Errorf("got vids %v, want %v", ids, tc.wantIDs)
+			}
+		})
+	}
+}
+
+func TestGetLatestFromFeedEntryDetails(t *testing.T) {
+	published := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ytFeedXML(fmt.Sprintf(ytFeedEntryFormat, "aaaaaaaaaaa", "Q&amp;A", published.Format(time.RFC3339))))
+	}))
+	defer srv.Close()
+	w := &watcher{cfg: &config{YTFeedBaseURL: srv.URL}, pod: &podcast{}}
+
+	vids, err := w.getLatestFromFeed(&channelSource{TitleFilterRE: regexp.MustCompile("")}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vids) != 1 {
+		t.Fatalf("got %d vids, want 1", len(vids))
+	}
+	vi := vids[0]
+	if vi.id != "aaaaaaaaaaa" || vi.title != "Q&A" || vi.desc != "About Q&A & more" || !vi.published.Equal(published) {
+		t.Errorf("got %+v", vi)
+	}
+}
+
+func TestGetLatestFromFeedHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	w := &watcher{cfg: &config{YTFeedBaseURL: srv.URL}, pod: &podcast{}}
+	if _, err := w.getLatestFromFeed(&channelSource{}, time.Time{}); err == nil {
+		t.Error("no error for a 404 response")
+	}
+}